@@ -0,0 +1,799 @@
+// Package apitest provides an in-memory fake of the mail.tm API for tests.
+//
+// The server implements the endpoints burnmail uses, including the Mercure
+// event stream, keeps accounts and messages in memory, and can be told to
+// fail requests to exercise error handling:
+//
+//	srv := apitest.NewServer()
+//	defer srv.Close()
+//
+//	client := srv.Client()
+//	srv.AddAccount("me@example.test", "secret")
+//	srv.Deliver("me@example.test", apitest.Message{Subject: "Hello"})
+package apitest
+
+import (
+	"burnmail/api"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDomain is the domain every new server offers.
+	DefaultDomain = "example.test"
+	// DefaultQuota is the mailbox size mail.tm gives new accounts.
+	DefaultQuota = 40 * 1000 * 1000
+	// DefaultTokenTTL is how long issued tokens stay valid.
+	DefaultTokenTTL = time.Hour
+)
+
+// Message is a message to deliver with Server.Deliver.
+type Message struct {
+	From        api.From
+	Subject     string
+	Text        string
+	HTML        []string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a delivered Message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Fault makes matching requests fail with Status instead of being served.
+type Fault struct {
+	// Method and Path select the requests to fail. Empty values match any
+	// method; Path matches by prefix.
+	Method string
+	Path   string
+	Status int
+	// RetryAfter is sent as the Retry-After header when set.
+	RetryAfter time.Duration
+	// Times is how many requests fail before the fault clears; 0 means one.
+	Times int
+}
+
+type account struct {
+	api.Account
+	password string
+	messages []*message
+	events   []event
+}
+
+type message struct {
+	detail      api.MessageDetail
+	attachments map[string][]byte
+}
+
+type event struct {
+	id   string
+	data []byte
+}
+
+// Server is a fake mail.tm API. It embeds the running httptest.Server.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	domains     []api.Domain
+	accounts    map[string]*account
+	tokens      map[string]issuedToken
+	tokenTTL    time.Duration
+	linkSources bool
+	faults      []*Fault
+	requests    []string
+	subscribers map[string][]chan event
+	nextID      int
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewServer starts a fake API offering DefaultDomain. Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		accounts:    make(map[string]*account),
+		tokens:      make(map[string]issuedToken),
+		tokenTTL:    DefaultTokenTTL,
+		subscribers: make(map[string][]chan event),
+		done:        make(chan struct{}),
+	}
+	s.AddDomain(DefaultDomain, true)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /domains", s.handleDomains)
+	mux.HandleFunc("POST /accounts", s.handleCreateAccount)
+	mux.HandleFunc("GET /accounts/{id}", s.handleGetAccount)
+	mux.HandleFunc("DELETE /accounts/{id}", s.handleDeleteAccount)
+	mux.HandleFunc("POST /token", s.handleToken)
+	mux.HandleFunc("GET /me", s.handleMe)
+	mux.HandleFunc("GET /messages", s.handleMessages)
+	mux.HandleFunc("GET /messages/{id}", s.handleGetMessage)
+	mux.HandleFunc("PATCH /messages/{id}", s.handlePatchMessage)
+	mux.HandleFunc("DELETE /messages/{id}", s.handleDeleteMessage)
+	mux.HandleFunc("GET /messages/{id}/attachment/{attachment}", s.handleAttachment)
+	mux.HandleFunc("GET /sources/{id}", s.handleSource)
+	mux.HandleFunc("GET /sources/{id}/download", s.handleSourceDownload)
+	mux.HandleFunc("GET /.well-known/mercure", s.handleEvents)
+
+	s.Server = httptest.NewServer(s.intercept(mux))
+	return s
+}
+
+// Close ends open event streams and shuts the server down.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() { close(s.done) })
+	s.Server.Close()
+}
+
+// Client returns an API client pointed at the server, without the
+// production rate limit. opts are applied last.
+func (s *Server) Client(opts ...api.Option) *api.Client {
+	defaults := []api.Option{
+		api.WithBaseURL(s.URL),
+		api.WithHTTPClient(s.Server.Client()),
+		api.WithRateLimit(1000, 1000),
+	}
+	return api.NewClient(append(defaults, opts...)...)
+}
+
+// AddDomain offers another domain for new accounts.
+func (s *Server) AddDomain(domain string, active bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.domains = append(s.domains, api.Domain{
+		ID:        s.newID("domain"),
+		Domain:    domain,
+		IsActive:  active,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+}
+
+// AddAccount creates an account directly, as if it had been registered.
+func (s *Server) AddAccount(address, password string) api.Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addAccount(address, password).Account
+}
+
+// SetQuota changes the quota of an account, in bytes.
+func (s *Server) SetQuota(address string, quota int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.accountByAddress(address)
+	if acc == nil {
+		return fmt.Errorf("apitest: no account %s", address)
+	}
+	acc.Quota = quota
+	return nil
+}
+
+// Deliver adds a message to the inbox of address, publishes it to event
+// stream subscribers and returns its ID.
+func (s *Server) Deliver(address string, m Message) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.accountByAddress(address)
+	if acc == nil {
+		return "", fmt.Errorf("apitest: no account %s", address)
+	}
+
+	now := time.Now()
+	msg := &message{attachments: make(map[string][]byte)}
+	msg.detail = api.MessageDetail{
+		Message: api.Message{
+			ID:        s.newID("msg"),
+			AccountID: "/accounts/" + acc.ID,
+			MsgID:     "<" + s.newID("mid") + "@" + DefaultDomain + ">",
+			From:      m.From,
+			To:        []api.To{{Address: address}},
+			Subject:   m.Subject,
+			Intro:     intro(m.Text),
+			HasAttach: len(m.Attachments) > 0,
+			Size:      len(m.Text),
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		Text: m.Text,
+		HTML: m.HTML,
+	}
+	msg.detail.DownloadURL = "/messages/" + msg.detail.ID + "/download"
+
+	for _, a := range m.Attachments {
+		id := s.newID("ATTACH")
+		msg.attachments[id] = a.Data
+		msg.detail.Attachments = append(msg.detail.Attachments, api.Attachment{
+			ID:          id,
+			Filename:    a.Filename,
+			ContentType: a.ContentType,
+			Size:        len(a.Data),
+			DownloadURL: "/messages/" + msg.detail.ID + "/attachment/" + id,
+		})
+		msg.detail.Size += len(a.Data)
+	}
+
+	acc.messages = append([]*message{msg}, acc.messages...)
+	acc.Used += int64(msg.detail.Size)
+	s.publish(acc, msg.detail.Message)
+
+	return msg.detail.ID, nil
+}
+
+// ExpireTokens invalidates every issued token, so the next authenticated
+// request is rejected with 401.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = make(map[string]issuedToken)
+}
+
+// SetTokenTTL sets how long tokens issued from now on stay valid. Their exp
+// claim matches, so clients can see the expiry coming.
+func (s *Server) SetTokenTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenTTL = ttl
+}
+
+// LinkSources makes /sources/{id} only link to the raw source through its
+// downloadUrl, as some servers do, instead of inlining it.
+func (s *Server) LinkSources() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.linkSources = true
+}
+
+// Inject registers a fault. Faults are checked in the order they were added.
+func (s *Server) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.Times <= 0 {
+		f.Times = 1
+	}
+	s.faults = append(s.faults, &f)
+}
+
+// Requests returns every request received so far as "METHOD /path".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// intercept records the request and applies the first matching fault.
+func (s *Server) intercept(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		var fault *Fault
+		for i, f := range s.faults {
+			if (f.Method == "" || f.Method == r.Method) && strings.HasPrefix(r.URL.Path, f.Path) {
+				fault = f
+				if f.Times--; f.Times == 0 {
+					s.faults = append(s.faults[:i], s.faults[i+1:]...)
+				}
+				break
+			}
+		}
+		s.mu.Unlock()
+
+		if fault == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if fault.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(fault.RetryAfter.Seconds())))
+		}
+		writeError(w, fault.Status, http.StatusText(fault.Status))
+	})
+}
+
+func (s *Server) handleDomains(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeCollection(w, s.domains, len(s.domains), "")
+}
+
+func (s *Server) handleCreateAccount(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Address  string `json:"address"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON body.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, domain, _ := strings.Cut(body.Address, "@")
+	if !s.domainActive(domain) {
+		writeViolation(w, "address", "The domain of this address is not available.")
+		return
+	}
+	if s.accountByAddress(body.Address) != nil {
+		writeViolation(w, "address", "This value is already used.")
+		return
+	}
+	if len(body.Password) < 6 {
+		writeViolation(w, "password", "This value is too short.")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, s.addAccount(body.Address, body.Password).Account)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Address  string `json:"address"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON body.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.accountByAddress(body.Address)
+	if acc == nil || acc.password != body.Password {
+		writeError(w, http.StatusUnauthorized, "Invalid credentials.")
+		return
+	}
+
+	expires := time.Now().Add(s.tokenTTL)
+	token := newToken(acc.ID, expires)
+	s.tokens[token] = issuedToken{accountID: acc.ID, expires: expires}
+	writeJSON(w, http.StatusOK, api.AuthResponse{Token: token, ID: acc.ID})
+}
+
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if acc := s.authorize(w, r); acc != nil {
+		writeJSON(w, http.StatusOK, acc.Account)
+	}
+}
+
+func (s *Server) handleGetAccount(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.authorize(w, r)
+	if acc == nil {
+		return
+	}
+	if acc.ID != r.PathValue("id") {
+		writeError(w, http.StatusForbidden, "Access Denied.")
+		return
+	}
+	writeJSON(w, http.StatusOK, acc.Account)
+}
+
+func (s *Server) handleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.authorize(w, r)
+	if acc == nil {
+		return
+	}
+	if acc.ID != r.PathValue("id") {
+		writeError(w, http.StatusForbidden, "Access Denied.")
+		return
+	}
+
+	delete(s.accounts, acc.ID)
+	for token, issued := range s.tokens {
+		if issued.accountID == acc.ID {
+			delete(s.tokens, token)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.authorize(w, r)
+	if acc == nil {
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	start := min((page-1)*api.MessagesPageSize, len(acc.messages))
+	end := min(start+api.MessagesPageSize, len(acc.messages))
+	members := make([]api.Message, 0, end-start)
+	for _, msg := range acc.messages[start:end] {
+		members = append(members, msg.detail.Message)
+	}
+
+	next := ""
+	if end < len(acc.messages) {
+		next = fmt.Sprintf("/messages?page=%d", page+1)
+	}
+	writeCollection(w, members, len(acc.messages), next)
+}
+
+func (s *Server) handleGetMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if msg := s.findMessage(w, r); msg != nil {
+		writeJSON(w, http.StatusOK, msg.detail)
+	}
+}
+
+func (s *Server) handlePatchMessage(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Seen    *bool `json:"seen"`
+		Flagged *bool `json:"flagged"`
+	}
+	// mail.tm marks the message as seen when the body is empty, and like any
+	// API Platform server only accepts JSON merge patches otherwise.
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		seen := true
+		body.Seen = &seen
+	} else if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/merge-patch+json") {
+		writeError(w, http.StatusUnsupportedMediaType, "The content-type is not supported.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.findMessage(w, r)
+	if msg == nil {
+		return
+	}
+	if body.Seen != nil {
+		msg.detail.Seen = *body.Seen
+	}
+	if body.Flagged != nil {
+		msg.detail.Flagged = *body.Flagged
+	}
+	msg.detail.UpdatedAt = time.Now()
+	writeJSON(w, http.StatusOK, map[string]bool{"seen": msg.detail.Seen, "flagged": msg.detail.Flagged})
+}
+
+func (s *Server) handleDeleteMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.authorize(w, r)
+	if acc == nil {
+		return
+	}
+	for i, msg := range acc.messages {
+		if msg.detail.ID == r.PathValue("id") {
+			acc.messages = append(acc.messages[:i], acc.messages[i+1:]...)
+			acc.Used -= int64(msg.detail.Size)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) handleAttachment(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	msg := s.findMessage(w, r)
+	var data []byte
+	var found bool
+	var contentType string
+	if msg != nil {
+		data, found = msg.attachments[r.PathValue("attachment")]
+		for _, a := range msg.detail.Attachments {
+			if a.ID == r.PathValue("attachment") {
+				contentType = a.ContentType
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if msg == nil {
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	_, _ = w.Write(data)
+}
+
+func (s *Server) handleSource(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.findMessage(w, r)
+	if msg == nil {
+		return
+	}
+
+	source := api.Source{ID: msg.detail.ID, DownloadURL: "/sources/" + msg.detail.ID + "/download"}
+	if !s.linkSources {
+		source.Data = rawSource(msg.detail)
+	}
+	writeJSON(w, http.StatusOK, source)
+}
+
+func (s *Server) handleSourceDownload(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.findMessage(w, r)
+	if msg == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "message/rfc822")
+	_, _ = io.WriteString(w, rawSource(msg.detail))
+}
+
+func rawSource(d api.MessageDetail) string {
+	return fmt.Sprintf("Message-ID: %s\r\nFrom: %s <%s>\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s",
+		d.MsgID, d.From.Name, d.From.Address, d.To[0].Address, d.Subject, d.CreatedAt.Format(time.RFC1123Z), d.Text)
+}
+
+// handleEvents serves the Mercure hub for one account topic, replaying the
+// events after Last-Event-ID before streaming new ones.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	acc := s.authorize(w, r)
+	if acc == nil {
+		s.mu.Unlock()
+		return
+	}
+	if r.URL.Query().Get("topic") != "/accounts/"+acc.ID {
+		s.mu.Unlock()
+		writeError(w, http.StatusForbidden, "Access Denied.")
+		return
+	}
+
+	var backlog []event
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		for i, ev := range acc.events {
+			if ev.id == lastID {
+				backlog = append(backlog, acc.events[i+1:]...)
+				break
+			}
+		}
+	}
+
+	ch := make(chan event, 16)
+	accountID := acc.ID
+	s.subscribers[accountID] = append(s.subscribers[accountID], ch)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		subs := s.subscribers[accountID]
+		for i, sub := range subs {
+			if sub == ch {
+				s.subscribers[accountID] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+	}()
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(ev event) {
+		_, _ = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", ev.id, ev.data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	for _, ev := range backlog {
+		send(ev)
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case ev := <-ch:
+			send(ev)
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// publish records an event for the account and hands it to subscribers.
+// The caller holds s.mu.
+func (s *Server) publish(acc *account, msg api.Message) {
+	payload := struct {
+		ID   string `json:"@id"`
+		Type string `json:"@type"`
+		api.Message
+	}{"/messages/" + msg.ID, "Message", msg}
+
+	data, _ := json.Marshal(payload)
+	ev := event{id: s.newID("urn:event"), data: data}
+	acc.events = append(acc.events, ev)
+
+	for _, ch := range s.subscribers[acc.ID] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// authorize returns the account owning the bearer token, or writes a 401.
+// The caller holds s.mu.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) *account {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		writeError(w, http.StatusUnauthorized, "JWT Token not found")
+		return nil
+	}
+
+	issued := s.tokens[token]
+	acc, ok := s.accounts[issued.accountID]
+	if !ok || time.Now().After(issued.expires) {
+		writeError(w, http.StatusUnauthorized, "Expired JWT Token")
+		return nil
+	}
+	return acc
+}
+
+// findMessage returns the requested message of the authorized account, or
+// writes the error. The caller holds s.mu.
+func (s *Server) findMessage(w http.ResponseWriter, r *http.Request) *message {
+	acc := s.authorize(w, r)
+	if acc == nil {
+		return nil
+	}
+	for _, msg := range acc.messages {
+		if msg.detail.ID == r.PathValue("id") {
+			return msg
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+	return nil
+}
+
+func (s *Server) addAccount(address, password string) *account {
+	now := time.Now()
+	acc := &account{
+		Account: api.Account{
+			ID:        s.newID("acc"),
+			Address:   address,
+			Quota:     DefaultQuota,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		password: password,
+	}
+	s.accounts[acc.ID] = acc
+	return acc
+}
+
+func (s *Server) accountByAddress(address string) *account {
+	for _, acc := range s.accounts {
+		if strings.EqualFold(acc.Address, address) {
+			return acc
+		}
+	}
+	return nil
+}
+
+func (s *Server) domainActive(domain string) bool {
+	for _, d := range s.domains {
+		if strings.EqualFold(d.Domain, domain) {
+			return d.IsActive
+		}
+	}
+	return false
+}
+
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%d", prefix, s.nextID)
+}
+
+func intro(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) > 120 {
+		return text[:120]
+	}
+	return text
+}
+
+// issuedToken records who a token belongs to and when it stops working.
+type issuedToken struct {
+	accountID string
+	expires   time.Time
+}
+
+// newToken returns an unsigned JWT shaped like the ones mail.tm issues.
+func newToken(accountID string, expires time.Time) string {
+	nonce := make([]byte, 12)
+	_, _ = rand.Read(nonce)
+
+	claims, _ := json.Marshal(map[string]any{
+		"iat": time.Now().Unix(),
+		"exp": expires.Unix(),
+		"id":  accountID,
+		"jti": hex.EncodeToString(nonce),
+	})
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"typ":"JWT","alg":"none"}`)) + "." + enc.EncodeToString(claims) + ".fake"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeCollection sends a Hydra collection, as mail.tm does for JSON-LD.
+func writeCollection(w http.ResponseWriter, members any, total int, next string) {
+	body := map[string]any{
+		"@type":            "hydra:Collection",
+		"hydra:member":     members,
+		"hydra:totalItems": total,
+	}
+	if next != "" {
+		body["hydra:view"] = map[string]string{"hydra:next": next}
+	}
+	w.Header().Set("Content-Type", "application/ld+json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, description string) {
+	writeJSON(w, status, map[string]any{
+		"@type":             "hydra:Error",
+		"hydra:title":       "An error occurred",
+		"hydra:description": description,
+	})
+}
+
+func writeViolation(w http.ResponseWriter, property, msg string) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+		"@type":             "ConstraintViolationList",
+		"hydra:title":       "An error occurred",
+		"hydra:description": property + ": " + msg,
+		"violations":        []api.Violation{{PropertyPath: property, Message: msg}},
+	})
+}
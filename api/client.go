@@ -6,67 +6,91 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 )
 
-const BaseURL = "https://api.mail.tm"
-
-var (
-	clientInstance *Client
-	clientOnce     sync.Once
+const (
+	DefaultBaseURL   = "https://api.mail.tm"
+	DefaultUserAgent = "burnmail"
 )
 
 type Client struct {
-	HTTPClient  *http.Client
-	token       string
-	mu          sync.RWMutex
-	rateLimiter chan struct{}
-	lastRequest time.Time
-	minDelay    time.Duration
-}
-
-func GetClient() *Client {
-	clientOnce.Do(func() {
-		limiter := make(chan struct{}, 5)
-		for i := 0; i < 5; i++ {
-			limiter <- struct{}{}
-		}
+	HTTPClient *http.Client
+	baseURL    string
+	mercureURL string
+	userAgent  string
+	token      string
+	address    string
+	password   string
+	onRefresh  func(token string)
+	refreshMu  sync.Mutex
+	mu         sync.RWMutex
+	limiter    *rateLimiter
+	logger     *slog.Logger
+}
 
-		clientInstance = &Client{
-			HTTPClient: &http.Client{
-				Timeout: 30 * time.Second,
-				Transport: &http.Transport{
-					MaxIdleConns:        10,
-					MaxIdleConnsPerHost: 10,
-					IdleConnTimeout:     90 * time.Second,
-					DisableKeepAlives:   false,
-					DisableCompression:  false,
-				},
-			},
-			rateLimiter: limiter,
-			minDelay:    200 * time.Millisecond,
-		}
-	})
-	return clientInstance
+// NewClient returns a client for mail.tm, or whatever the options point it
+// at. Each client has its own token, so several can talk to different
+// inboxes at once. They share one rate limiter per process, since the
+// server counts requests per address, unless WithRateLimit gives a client
+// its own.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		HTTPClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: newDefaultTransport(),
+		},
+		baseURL:   DefaultBaseURL,
+		userAgent: DefaultUserAgent,
+		limiter:   sharedLimiter,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.logger != nil {
+		httpClient := *c.HTTPClient
+		httpClient.Transport = NewLoggingTransport(httpClient.Transport, c.logger)
+		c.HTTPClient = &httpClient
+	}
+	return c
 }
 
-func (c *Client) waitForRateLimit() {
-	<-c.rateLimiter
+// RateLimitState reports the client-side rate limiter, including whether
+// requests are paused after a 429.
+func (c *Client) RateLimitState() RateLimitState {
+	return c.limiter.State()
+}
 
-	c.mu.Lock()
-	since := time.Since(c.lastRequest)
-	if since < c.minDelay {
-		time.Sleep(c.minDelay - since)
+// send renews a token that is about to expire, waits for the rate limiter,
+// sends req and feeds 429s back into the limiter so every request backs off
+// together.
+func (c *Client) send(httpClient *http.Client, req *http.Request) (*http.Response, error) {
+	c.refreshIfExpiring(req)
+
+	waited, err := c.limiter.Wait(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	if waited > 0 {
+		req = req.WithContext(withRateWait(req.Context(), waited))
 	}
-	c.lastRequest = time.Now()
-	c.mu.Unlock()
 
-	go func() {
-		time.Sleep(c.minDelay)
-		c.rateLimiter <- struct{}{}
-	}()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		c.limiter.OnRateLimited(parseRetryAfter(resp.Header.Get("Retry-After")))
+	} else {
+		c.limiter.OnSuccess()
+	}
+	return resp, nil
 }
 
 func (c *Client) SetToken(token string) {
@@ -81,19 +105,143 @@ func (c *Client) GetToken() string {
 	return c.token
 }
 
+// SetCredentials stores the account login so the client can fetch a new
+// token by itself when the current one is rejected.
+func (c *Client) SetCredentials(address, password string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.address = address
+	c.password = password
+}
+
+// OnTokenRefresh registers fn to be called with every token obtained by an
+// automatic re-login, so the caller can persist it.
+func (c *Client) OnTokenRefresh(fn func(token string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onRefresh = fn
+}
+
+// SetBaseURL points the client at another Hydra-compatible API.
+func (c *Client) SetBaseURL(baseURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.baseURL = baseURL
+}
+
+func (c *Client) BaseURL() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.baseURL
+}
+
+// newRequest builds a request bound to ctx against the configured base URL,
+// adding the bearer token when auth is set.
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader, auth bool) (*http.Request, error) {
+	return c.newRequestURL(ctx, method, c.BaseURL()+path, body, auth)
+}
+
+func (c *Client) newRequestURL(ctx context.Context, method, rawURL string, body io.Reader, auth bool) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if auth {
+		req.Header.Set("Authorization", "Bearer "+c.GetToken())
+	}
+	c.setUserAgent(req)
+	return req, nil
+}
+
+func (c *Client) setUserAgent(req *http.Request) {
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+}
+
+// do sends req and returns the response if its status is the expected one.
+// Any other status is turned into an *APIError and the body is closed.
+// An authenticated request rejected with 401 is replayed once after logging
+// in again with the stored credentials.
+func (c *Client) do(req *http.Request, expected int) (*http.Response, error) {
+	return c.doWith(c.HTTPClient, req, expected)
+}
+
+// streamClient shares the transport of HTTPClient but has no overall
+// timeout, for responses that are read for as long as ctx allows.
+func (c *Client) streamClient() *http.Client {
+	return &http.Client{Transport: c.HTTPClient.Transport}
+}
+
+func (c *Client) doWith(httpClient *http.Client, req *http.Request, expected int) (*http.Response, error) {
+	resp, err := c.send(httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && req.Header.Get("Authorization") != "" && c.hasCredentials() {
+		apiErr := newAPIError(resp)
+		_ = resp.Body.Close()
+
+		stale := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if err := c.refreshToken(req.Context(), stale); err != nil {
+			return nil, &TokenRefreshError{Rejected: apiErr, Err: err}
+		}
+
+		retry := req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			retry.Body = body
+		}
+		retry.Header.Set("Authorization", "Bearer "+c.GetToken())
+
+		resp, err = c.send(httpClient, retry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != expected {
+		defer func() { _ = resp.Body.Close() }()
+		return nil, newAPIError(resp)
+	}
+
+	return resp, nil
+}
+
 type Domain struct {
 	ID        string    `json:"id"`
 	Domain    string    `json:"domain"`
 	IsActive  bool      `json:"isActive"`
+	IsPrivate bool      `json:"isPrivate"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
 type Account struct {
-	ID        string    `json:"id"`
-	Address   string    `json:"address"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID         string    `json:"id"`
+	Address    string    `json:"address"`
+	Quota      int64     `json:"quota"`
+	Used       int64     `json:"used"`
+	IsDisabled bool      `json:"isDisabled"`
+	IsDeleted  bool      `json:"isDeleted"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// QuotaUsage returns the share of the mailbox quota in use, from 0 to 1, or
+// -1 when the server did not report a quota.
+func (a *Account) QuotaUsage() float64 {
+	if a.Quota <= 0 {
+		return -1
+	}
+	return float64(a.Used) / float64(a.Quota)
 }
 
 type Message struct {
@@ -105,6 +253,7 @@ type Message struct {
 	Subject     string    `json:"subject"`
 	Intro       string    `json:"intro"`
 	Seen        bool      `json:"seen"`
+	Flagged     bool      `json:"flagged"`
 	IsDeleted   bool      `json:"isDeleted"`
 	HasAttach   bool      `json:"hasAttachments"`
 	Size        int       `json:"size"`
@@ -135,7 +284,6 @@ type MessageDetail struct {
 	Message
 	CC            []any                  `json:"cc"`
 	BCC           []any                  `json:"bcc"`
-	Flagged       bool                   `json:"flagged"`
 	Verifications map[string]interface{} `json:"verifications"`
 	Retention     bool                   `json:"retention"`
 	RetentionDate time.Time              `json:"retentionDate"`
@@ -144,35 +292,81 @@ type MessageDetail struct {
 	Attachments   []Attachment           `json:"attachments"`
 }
 
+type Source struct {
+	ID          string `json:"id"`
+	DownloadURL string `json:"downloadUrl"`
+	Data        string `json:"data"`
+}
+
 type AuthResponse struct {
 	Token string `json:"token"`
 	ID    string `json:"id"`
 }
 
 type hydraResponse struct {
-	Member json.RawMessage `json:"hydra:member"`
+	Member     json.RawMessage `json:"hydra:member"`
+	TotalItems *int            `json:"hydra:totalItems"`
+	View       *hydraView      `json:"hydra:view"`
 }
 
-func (c *Client) GetDomains() ([]Domain, error) {
-	c.waitForRateLimit()
+type hydraView struct {
+	Next string `json:"hydra:next"`
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// MessagesPageSize is the number of messages the API returns per page.
+const MessagesPageSize = 30
 
-	req, err := http.NewRequestWithContext(ctx, "GET", BaseURL+"/domains", nil)
+// MessagesPage is one page of the message list. TotalItems is -1 when the
+// server does not report it.
+type MessagesPage struct {
+	Messages   []Message
+	Page       int
+	TotalItems int
+	HasNext    bool
+}
+
+func (c *Client) hasCredentials() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.address != "" && c.password != ""
+}
+
+// refreshToken logs in again unless another request already replaced the
+// stale token while this one was waiting.
+func (c *Client) refreshToken(ctx context.Context, stale string) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	if c.GetToken() != stale {
+		return nil
+	}
+
+	c.mu.RLock()
+	address, password, onRefresh := c.address, c.password, c.onRefresh
+	c.mu.RUnlock()
+
+	token, err := c.Login(ctx, address, password)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if onRefresh != nil {
+		onRefresh(token)
 	}
+	return nil
+}
 
-	resp, err := c.HTTPClient.Do(req)
+func (c *Client) GetDomains(ctx context.Context) ([]Domain, error) {
+	req, err := c.newRequest(ctx, "GET", "/domains", nil, false)
 	if err != nil {
 		return nil, err
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get domains: status %d", resp.StatusCode)
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
 	}
+	defer func() { _ = resp.Body.Close() }()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -199,7 +393,7 @@ func (c *Client) GetDomains() ([]Domain, error) {
 	return nil, fmt.Errorf("unexpected API response format")
 }
 
-func (c *Client) CreateAccount(address, password string) (*Account, error) {
+func (c *Client) CreateAccount(ctx context.Context, address, password string) (*Account, error) {
 	payload := map[string]string{
 		"address":  address,
 		"password": password,
@@ -210,16 +404,16 @@ func (c *Client) CreateAccount(address, password string) (*Account, error) {
 		return nil, err
 	}
 
-	resp, err := c.HTTPClient.Post(BaseURL+"/accounts", "application/json", bytes.NewBuffer(jsonData))
+	req, err := c.newRequest(ctx, "POST", "/accounts", bytes.NewReader(jsonData), false)
 	if err != nil {
 		return nil, err
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to create account: status %d, body: %s", resp.StatusCode, string(body))
+	resp, err := c.do(req, http.StatusCreated)
+	if err != nil {
+		return nil, err
 	}
+	defer func() { _ = resp.Body.Close() }()
 
 	var account Account
 	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
@@ -229,7 +423,7 @@ func (c *Client) CreateAccount(address, password string) (*Account, error) {
 	return &account, nil
 }
 
-func (c *Client) Login(address, password string) (string, error) {
+func (c *Client) Login(ctx context.Context, address, password string) (string, error) {
 	payload := map[string]string{
 		"address":  address,
 		"password": password,
@@ -240,16 +434,16 @@ func (c *Client) Login(address, password string) (string, error) {
 		return "", err
 	}
 
-	resp, err := c.HTTPClient.Post(BaseURL+"/token", "application/json", bytes.NewBuffer(jsonData))
+	req, err := c.newRequest(ctx, "POST", "/token", bytes.NewReader(jsonData), false)
 	if err != nil {
 		return "", err
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to login: status %d, body: %s", resp.StatusCode, string(body))
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return "", err
 	}
+	defer func() { _ = resp.Body.Close() }()
 
 	var authResp AuthResponse
 	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
@@ -260,37 +454,51 @@ func (c *Client) Login(address, password string) (string, error) {
 	return authResp.Token, nil
 }
 
-func (c *Client) GetMessages() ([]Message, error) {
-	c.waitForRateLimit()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", BaseURL+"/messages", nil)
+// GetMessages returns the first page of messages, newest first. Use
+// GetMessagesPage or GetAllMessages to see the rest of a busy inbox.
+func (c *Client) GetMessages(ctx context.Context) ([]Message, error) {
+	page, err := c.GetMessagesPage(ctx, 1)
 	if err != nil {
 		return nil, err
 	}
+	return page.Messages, nil
+}
 
-	req.Header.Set("Authorization", "Bearer "+c.GetToken())
+// GetMessagesPage returns one page of messages. Pages start at 1.
+func (c *Client) GetMessagesPage(ctx context.Context, page int) (*MessagesPage, error) {
+	if page < 1 {
+		page = 1
+	}
 
-	resp, err := c.HTTPClient.Do(req)
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("/messages?page=%d", page), nil, true)
 	if err != nil {
 		return nil, err
 	}
-	defer func() { _ = resp.Body.Close() }()
+	// The JSON-LD form carries hydra:totalItems and hydra:view, which plain
+	// JSON leaves out.
+	req.Header.Set("Accept", "application/ld+json")
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get messages: status %d", resp.StatusCode)
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
 	}
+	defer func() { _ = resp.Body.Close() }()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
+	result := &MessagesPage{Page: page, Messages: []Message{}}
+
+	// Servers that ignore the Accept header send a bare array; a full page
+	// then is the only hint that another one may follow.
 	var messages []Message
 	if err := json.Unmarshal(body, &messages); err == nil {
-		return messages, nil
+		result.Messages = messages
+		result.TotalItems = -1
+		result.HasNext = len(messages) >= MessagesPageSize
+		return result, nil
 	}
 
 	var hydra hydraResponse
@@ -299,85 +507,155 @@ func (c *Client) GetMessages() ([]Message, error) {
 	}
 
 	if len(hydra.Member) > 0 {
-		if err := json.Unmarshal(hydra.Member, &messages); err != nil {
+		if err := json.Unmarshal(hydra.Member, &result.Messages); err != nil {
 			return nil, err
 		}
-		return messages, nil
 	}
 
-	return []Message{}, nil
+	result.TotalItems = -1
+	if hydra.TotalItems != nil {
+		result.TotalItems = *hydra.TotalItems
+	}
+
+	switch {
+	case hydra.View != nil:
+		result.HasNext = hydra.View.Next != ""
+	case result.TotalItems >= 0:
+		result.HasNext = page*MessagesPageSize < result.TotalItems
+	default:
+		result.HasNext = len(result.Messages) >= MessagesPageSize
+	}
+
+	return result, nil
 }
 
-func (c *Client) GetMessage(id string) (*MessageDetail, error) {
-	c.waitForRateLimit()
+// GetAllMessages walks every page of the inbox.
+func (c *Client) GetAllMessages(ctx context.Context) ([]Message, error) {
+	var all []Message
+	for page := 1; ; page++ {
+		result, err := c.GetMessagesPage(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, result.Messages...)
+		if !result.HasNext || len(result.Messages) == 0 {
+			break
+		}
+	}
+	if all == nil {
+		all = []Message{}
+	}
+	return all, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+func (c *Client) GetMessage(ctx context.Context, id string) (*MessageDetail, error) {
+	req, err := c.newRequest(ctx, "GET", "/messages/"+id, nil, true)
+	if err != nil {
+		return nil, err
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", BaseURL+"/messages/"+id, nil)
+	resp, err := c.do(req, http.StatusOK)
 	if err != nil {
 		return nil, err
 	}
+	defer func() { _ = resp.Body.Close() }()
 
-	req.Header.Set("Authorization", "Bearer "+c.GetToken())
+	var message MessageDetail
+	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+		return nil, err
+	}
 
-	resp, err := c.HTTPClient.Do(req)
+	return &message, nil
+}
+
+// GetMessageSource returns the raw RFC 822 source of a message, headers
+// included.
+func (c *Client) GetMessageSource(ctx context.Context, id string) ([]byte, error) {
+	req, err := c.newRequest(ctx, "GET", "/sources/"+id, nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req, http.StatusOK)
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get message: status %d", resp.StatusCode)
+	var source Source
+	if err := json.NewDecoder(resp.Body).Decode(&source); err != nil {
+		return nil, err
 	}
 
-	var message MessageDetail
-	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+	if source.Data != "" || source.DownloadURL == "" {
+		return []byte(source.Data), nil
+	}
+
+	// Some servers only link to the source instead of inlining it.
+	downloadURL, err := c.resolveURL(source.DownloadURL)
+	if err != nil {
+		return nil, err
+	}
+	req, err = c.newRequestURL(ctx, "GET", downloadURL, nil, true)
+	if err != nil {
 		return nil, err
 	}
 
-	return &message, nil
+	download, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = download.Body.Close() }()
+
+	return io.ReadAll(download.Body)
 }
 
-func (c *Client) DeleteAccount(accountID string) error {
-	req, err := http.NewRequest("DELETE", BaseURL+"/accounts/"+accountID, nil)
+// resolveURL resolves a link from a response against the base URL. Links
+// to another host are rejected, since the request carries the token.
+func (c *Client) resolveURL(ref string) (string, error) {
+	base, err := url.Parse(c.BaseURL())
 	if err != nil {
-		return err
+		return "", err
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid link %q: %v", ref, err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.GetToken())
+	resolved := base.ResolveReference(u)
+	if resolved.Scheme != base.Scheme || resolved.Host != base.Host {
+		return "", fmt.Errorf("refusing to follow link %q to another host", ref)
+	}
+	return resolved.String(), nil
+}
 
-	resp, err := c.HTTPClient.Do(req)
+func (c *Client) DeleteAccount(ctx context.Context, accountID string) error {
+	req, err := c.newRequest(ctx, "DELETE", "/accounts/"+accountID, nil, true)
 	if err != nil {
 		return err
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("failed to delete account: status %d", resp.StatusCode)
+	resp, err := c.do(req, http.StatusNoContent)
+	if err != nil {
+		return err
 	}
+	_ = resp.Body.Close()
 
 	return nil
 }
 
-func (c *Client) GetAccount(accountID string) (*Account, error) {
-	req, err := http.NewRequest("GET", BaseURL+"/accounts/"+accountID, nil)
+func (c *Client) GetAccount(ctx context.Context, accountID string) (*Account, error) {
+	req, err := c.newRequest(ctx, "GET", "/accounts/"+accountID, nil, true)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.GetToken())
-
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.do(req, http.StatusOK)
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get account: status %d", resp.StatusCode)
-	}
-
 	var account Account
 	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
 		return nil, err
@@ -386,71 +664,123 @@ func (c *Client) GetAccount(accountID string) (*Account, error) {
 	return &account, nil
 }
 
-func (c *Client) DeleteMessage(id string) error {
-	req, err := http.NewRequest("DELETE", BaseURL+"/messages/"+id, nil)
+// GetMe returns the account the current token belongs to, including its
+// quota and usage.
+func (c *Client) GetMe(ctx context.Context) (*Account, error) {
+	req, err := c.newRequest(ctx, "GET", "/me", nil, true)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.GetToken())
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
 
-	resp, err := c.HTTPClient.Do(req)
+	var account Account
+	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+func (c *Client) DeleteMessage(ctx context.Context, id string) error {
+	req, err := c.newRequest(ctx, "DELETE", "/messages/"+id, nil, true)
 	if err != nil {
 		return err
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("failed to delete message: status %d", resp.StatusCode)
+	resp, err := c.do(req, http.StatusNoContent)
+	if err != nil {
+		return err
 	}
+	_ = resp.Body.Close()
 
 	return nil
 }
 
-func (c *Client) MarkMessageAsRead(id string) error {
-	req, err := http.NewRequest("PATCH", BaseURL+"/messages/"+id, nil)
+// MarkMessageAsRead marks a message as seen.
+func (c *Client) MarkMessageAsRead(ctx context.Context, id string) error {
+	seen := true
+	return c.UpdateMessage(ctx, id, &seen, nil)
+}
+
+// UpdateMessage changes the read and flagged state of a message. A nil
+// value leaves that field as it is.
+func (c *Client) UpdateMessage(ctx context.Context, id string, seen, flagged *bool) error {
+	patch := struct {
+		Seen    *bool `json:"seen,omitempty"`
+		Flagged *bool `json:"flagged,omitempty"`
+	}{seen, flagged}
+
+	jsonData, err := json.Marshal(patch)
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.GetToken())
-
-	resp, err := c.HTTPClient.Do(req)
+	req, err := c.newRequest(ctx, "PATCH", "/messages/"+id, bytes.NewReader(jsonData), true)
 	if err != nil {
 		return err
 	}
-	defer func() { _ = resp.Body.Close() }()
+	req.Header.Set("Content-Type", "application/merge-patch+json")
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to mark message as read: status %d", resp.StatusCode)
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return err
 	}
+	_ = resp.Body.Close()
 
 	return nil
 }
 
-func (c *Client) DownloadAttachment(messageID, attachmentID string) ([]byte, error) {
-	c.waitForRateLimit()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
+// ProgressFunc reports the bytes written so far and the expected total,
+// which is -1 when the server does not send a length.
+type ProgressFunc func(written, total int64)
 
-	url := fmt.Sprintf("%s/messages/%s/attachment/%s", BaseURL, messageID, attachmentID)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
+// DownloadAttachment returns the whole attachment in memory. Prefer
+// DownloadAttachmentTo for anything that may be large.
+func (c *Client) DownloadAttachment(ctx context.Context, messageID, attachmentID string) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := c.DownloadAttachmentTo(ctx, messageID, attachmentID, &buf, nil); err != nil {
 		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	req.Header.Set("Authorization", "Bearer "+c.GetToken())
+// DownloadAttachmentTo streams an attachment into w and returns the number
+// of bytes written. progress, if not nil, is called after every write.
+func (c *Client) DownloadAttachmentTo(ctx context.Context, messageID, attachmentID string, w io.Writer, progress ProgressFunc) (int64, error) {
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("/messages/%s/attachment/%s", messageID, attachmentID), nil, true)
+	if err != nil {
+		return 0, err
+	}
 
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.doWith(c.streamClient(), req, http.StatusOK)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to download attachment: status %d", resp.StatusCode)
+	if progress != nil {
+		w = &progressWriter{w: w, total: resp.ContentLength, progress: progress}
+		progress(0, resp.ContentLength)
 	}
 
-	return io.ReadAll(resp.Body)
+	return io.Copy(w, resp.Body)
+}
+
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	p.progress(p.written, p.total)
+	return n, err
 }
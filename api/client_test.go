@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func newTestClient(baseURL string) *Client {
+	return NewClient(
+		WithBaseURL(baseURL),
+		WithHTTPClient(&http.Client{}),
+		WithRateLimit(1000, 1000),
+	)
+}
+
+func TestTokenRefreshOn401(t *testing.T) {
+	logins := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			logins++
+			_ = json.NewEncoder(w).Encode(AuthResponse{Token: "fresh", ID: "acc"})
+		case "/messages/1":
+			if r.Header.Get("Authorization") != "Bearer fresh" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	client := newTestClient(srv.URL)
+	client.SetToken("expired")
+	client.SetCredentials("me@example.com", "secret")
+
+	var refreshed string
+	client.OnTokenRefresh(func(token string) { refreshed = token })
+
+	if err := client.DeleteMessage(context.Background(), "1"); err != nil {
+		t.Fatalf("DeleteMessage failed: %v", err)
+	}
+	if logins != 1 {
+		t.Errorf("logins = %d, want 1", logins)
+	}
+	if refreshed != "fresh" || client.GetToken() != "fresh" {
+		t.Errorf("token not refreshed: callback %q, client %q", refreshed, client.GetToken())
+	}
+}
+
+func TestNoRefreshWithoutCredentials(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			t.Error("unexpected login without credentials")
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(srv.URL)
+	client.SetToken("expired")
+
+	err := client.DeleteMessage(context.Background(), "1")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("DeleteMessage error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestTokenRefreshErrorKeepsLoginFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(srv.URL)
+	client.SetToken("expired")
+	client.SetCredentials("me@example.com", "secret")
+
+	err := client.DeleteMessage(context.Background(), "1")
+	var refreshErr *TokenRefreshError
+	if !errors.As(err, &refreshErr) || !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("DeleteMessage error = %v, want a TokenRefreshError for the 401", err)
+	}
+	if !errors.Is(refreshErr.Err, ErrRateLimited) {
+		t.Errorf("refresh error = %v, want the rate limited login", refreshErr.Err)
+	}
+}
+
+func TestGetMessageSourceDownloadURL(t *testing.T) {
+	var downloadURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sources/1":
+			_ = json.NewEncoder(w).Encode(Source{ID: "1", DownloadURL: downloadURL})
+		case "/sources/1/download":
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("Subject: raw"))
+		}
+	}))
+	defer srv.Close()
+
+	client := newTestClient(srv.URL)
+	client.SetToken("token")
+
+	downloadURL = srv.URL + "/sources/1/download"
+	if source, err := client.GetMessageSource(context.Background(), "1"); err != nil || string(source) != "Subject: raw" {
+		t.Errorf("absolute downloadUrl: GetMessageSource() = %q, %v", source, err)
+	}
+
+	downloadURL = "https://elsewhere.test/sources/1/download"
+	if _, err := client.GetMessageSource(context.Background(), "1"); err == nil {
+		t.Error("a downloadUrl on another host should be refused rather than sent the token")
+	}
+}
+
+func TestGetAllMessagesWalksPages(t *testing.T) {
+	const total = MessagesPageSize + 5
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		start, end := 0, MessagesPageSize
+		view := map[string]string{"hydra:next": "/messages?page=2"}
+		if page == "2" {
+			start, end = MessagesPageSize, total
+			view = map[string]string{}
+		}
+
+		members := make([]Message, 0, end-start)
+		for i := start; i < end; i++ {
+			members = append(members, Message{ID: fmt.Sprintf("msg-%d", i)})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"hydra:member":     members,
+			"hydra:totalItems": total,
+			"hydra:view":       view,
+		})
+	}))
+	defer srv.Close()
+
+	client := newTestClient(srv.URL)
+
+	first, err := client.GetMessagesPage(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("GetMessagesPage failed: %v", err)
+	}
+	if !first.HasNext || first.TotalItems != total {
+		t.Errorf("page 1: HasNext = %v, TotalItems = %d; want true, %d", first.HasNext, first.TotalItems, total)
+	}
+
+	all, err := client.GetAllMessages(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllMessages failed: %v", err)
+	}
+	if len(all) != total {
+		t.Errorf("GetAllMessages returned %d messages, want %d", len(all), total)
+	}
+}
+
+func TestGetMeReportsQuota(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/me" || r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"id":"acc","address":"a@b.c","quota":40000000,"used":36000000,"isDisabled":false,"isDeleted":false}`)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(srv.URL)
+	client.SetToken("tok")
+
+	account, err := client.GetMe(context.Background())
+	if err != nil {
+		t.Fatalf("GetMe failed: %v", err)
+	}
+	if account.Quota != 40000000 || account.Used != 36000000 {
+		t.Errorf("quota = %d, used = %d", account.Quota, account.Used)
+	}
+	if usage := account.QuotaUsage(); usage != 0.9 {
+		t.Errorf("QuotaUsage() = %v, want 0.9", usage)
+	}
+	if usage := (&Account{}).QuotaUsage(); usage != -1 {
+		t.Errorf("QuotaUsage() without quota = %v, want -1", usage)
+	}
+}
+
+func TestNewClientInstancesAreIndependent(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen[r.Header.Get("Authorization")] = r.Header.Get("User-Agent")
+		mu.Unlock()
+		_, _ = fmt.Fprint(w, `{"id":"acc"}`)
+	}))
+	defer srv.Close()
+
+	first := NewClient(WithBaseURL(srv.URL+"/"), WithToken("one"), WithUserAgent("test/1"))
+	second := NewClient(WithBaseURL(srv.URL), WithToken("two"))
+
+	for _, client := range []*Client{first, second} {
+		if _, err := client.GetMe(context.Background()); err != nil {
+			t.Fatalf("GetMe failed: %v", err)
+		}
+	}
+
+	if seen["Bearer one"] != "test/1" {
+		t.Errorf("first client sent User-Agent %q, want test/1", seen["Bearer one"])
+	}
+	if seen["Bearer two"] != DefaultUserAgent {
+		t.Errorf("second client sent User-Agent %q, want %q", seen["Bearer two"], DefaultUserAgent)
+	}
+	if first.GetToken() != "one" || second.GetToken() != "two" {
+		t.Error("clients should not share their token")
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLoggedBody caps how much of a request or response body is logged.
+const maxLoggedBody = 2048
+
+const redacted = "[REDACTED]"
+
+var (
+	secretFieldPattern = regexp.MustCompile(`("(?:password|token)"\s*:\s*)"[^"]*"?`)
+	bearerPattern      = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9\-_.~+/=]+`)
+)
+
+type rateWaitKey struct{}
+
+// withRateWait records on ctx how long the request waited for the rate
+// limiter, for the logging transport to report.
+func withRateWait(ctx context.Context, waited time.Duration) context.Context {
+	return context.WithValue(ctx, rateWaitKey{}, waited)
+}
+
+// loggingTransport logs every request at debug level with secrets redacted.
+type loggingTransport struct {
+	next   http.RoundTripper
+	logger *slog.Logger
+}
+
+// NewLoggingTransport wraps next so every request and response is logged to
+// logger at debug level. Bearer tokens and password or token fields in JSON
+// bodies are redacted, and bodies are truncated.
+func NewLoggingTransport(next http.RoundTripper, logger *slog.Logger) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &loggingTransport{next: next, logger: logger}
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attrs := []any{
+		slog.String("method", req.Method),
+		slog.String("url", redact(req.URL.String())),
+		slog.Bool("auth", req.Header.Get("Authorization") != ""),
+	}
+	if waited, ok := req.Context().Value(rateWaitKey{}).(time.Duration); ok && waited >= time.Millisecond {
+		attrs = append(attrs, slog.Duration("rate_wait", waited))
+	}
+	if req.GetBody != nil && req.ContentLength != 0 {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(io.LimitReader(body, maxLoggedBody+1))
+			_ = body.Close()
+			attrs = append(attrs, slog.String("request_body", formatBody(data, req.ContentLength)))
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	attrs = append(attrs, slog.Duration("latency", time.Since(start)))
+
+	if err != nil {
+		t.logger.Debug("http request failed", append(attrs, slog.String("error", redact(err.Error())))...)
+		return nil, err
+	}
+
+	attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	if logBody(resp.Header.Get("Content-Type")) {
+		peeked, _ := io.ReadAll(io.LimitReader(resp.Body, maxLoggedBody+1))
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(peeked), resp.Body), resp.Body}
+		attrs = append(attrs, slog.String("response_body", formatBody(peeked, resp.ContentLength)))
+	}
+
+	t.logger.Debug("http request", attrs...)
+	return resp, nil
+}
+
+// logBody reports whether a response body is text worth logging. Event
+// streams are left alone, since peeking at them would block.
+func logBody(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"), strings.HasSuffix(mediaType, "json"):
+		return true
+	}
+	return false
+}
+
+func formatBody(data []byte, length int64) string {
+	body := string(data)
+	if len(data) > maxLoggedBody {
+		body = string(data[:maxLoggedBody]) + "…"
+		if length > 0 {
+			body += " (" + strconv.FormatInt(length, 10) + " bytes)"
+		}
+	}
+	return redact(body)
+}
+
+// redact hides bearer tokens and password or token fields in s.
+func redact(s string) string {
+	s = bearerPattern.ReplaceAllString(s, "${1}"+redacted)
+	return secretFieldPattern.ReplaceAllString(s, `${1}"`+redacted+`"`)
+}
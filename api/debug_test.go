@@ -0,0 +1,72 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`{"address":"a@b.c","password":"hunter22"}`, `{"address":"a@b.c","password":"[REDACTED]"}`},
+		{`{"token": "eyJ.abc.def","id":"1"}`, `{"token": "[REDACTED]","id":"1"}`},
+		{`{"password":"trunc`, `{"password":"[REDACTED]"`},
+		{"Authorization: Bearer eyJ.abc.def", "Authorization: Bearer [REDACTED]"},
+		{`{"subject":"no secrets here"}`, `{"subject":"no secrets here"}`},
+	}
+	for _, tt := range tests {
+		if got := redact(tt.in); got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLoggingTransportRedactsSecrets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/token":
+			_, _ = w.Write([]byte(`{"token":"eyJ.secret.jwt","id":"acc"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"detail":"backend exploded"}`))
+		}
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := NewClient(
+		WithBaseURL(srv.URL),
+		WithHTTPClient(&http.Client{}),
+		WithRateLimit(20, 1),
+		WithLogger(logger),
+	)
+
+	ctx := context.Background()
+	token, err := client.Login(ctx, "user@example.test", "hunter22")
+	if err != nil || token != "eyJ.secret.jwt" {
+		t.Fatalf("Login() = %q, %v; the logged body must still reach the caller", token, err)
+	}
+	if _, err := client.GetMessages(ctx); err == nil {
+		t.Fatal("GetMessages should fail with a 500")
+	}
+
+	out := logs.String()
+	for _, secret := range []string{"hunter22", "eyJ.secret.jwt"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log leaks %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{"method=POST", "status=500", "latency=", "rate_wait=", "backend exploded", "auth=true"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log is missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentinel errors matched by APIError through errors.Is.
+var (
+	ErrUnauthorized   = errors.New("unauthorized")
+	ErrRateLimited    = errors.New("rate limited")
+	ErrNotFound       = errors.New("not found")
+	ErrAddressTaken   = errors.New("address already taken")
+	ErrDomainRejected = errors.New("domain rejected")
+)
+
+// maxErrorBody caps how much of an error response is read.
+const maxErrorBody = 64 * 1024
+
+// Violation is a single constraint violation from a Hydra error body.
+type Violation struct {
+	PropertyPath string `json:"propertyPath"`
+	Message      string `json:"message"`
+	Code         string `json:"code,omitempty"`
+}
+
+// APIError is returned for any response with an unexpected status code.
+type APIError struct {
+	StatusCode  int
+	Method      string
+	Endpoint    string
+	Description string
+	Violations  []Violation
+	RetryAfter  time.Duration
+}
+
+type hydraError struct {
+	Title       string      `json:"hydra:title"`
+	Description string      `json:"hydra:description"`
+	Detail      string      `json:"detail"`
+	Message     string      `json:"message"`
+	Violations  []Violation `json:"violations"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s: status %d", e.Method, e.Endpoint, e.StatusCode)
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	return msg
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrAddressTaken:
+		if e.StatusCode != http.StatusUnprocessableEntity {
+			return false
+		}
+		for _, v := range e.Violations {
+			if v.PropertyPath == "address" && strings.Contains(strings.ToLower(v.Message), "already used") {
+				return true
+			}
+		}
+	case ErrDomainRejected:
+		if e.StatusCode != http.StatusUnprocessableEntity {
+			return false
+		}
+		for _, v := range e.Violations {
+			if v.PropertyPath == "domain" || strings.Contains(strings.ToLower(v.Message), "domain") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TokenRefreshError is returned when a request was rejected with 401 and
+// logging in again with the stored credentials failed as well. It matches
+// the rejection through errors.Is; Err is why the new login failed, which
+// tells an account that is gone from a server that could not be reached.
+type TokenRefreshError struct {
+	Rejected *APIError
+	Err      error
+}
+
+func (e *TokenRefreshError) Error() string {
+	return fmt.Sprintf("%v (token refresh failed: %v)", e.Rejected, e.Err)
+}
+
+func (e *TokenRefreshError) Unwrap() error {
+	return e.Rejected
+}
+
+// newAPIError builds an APIError from a failed response, consuming its body.
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     resp.Request.Method,
+		Endpoint:   resp.Request.URL.Path,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	var hydra hydraError
+	if err := json.Unmarshal(body, &hydra); err == nil {
+		apiErr.Violations = hydra.Violations
+		for _, desc := range []string{hydra.Description, hydra.Detail, hydra.Message, hydra.Title} {
+			if desc != "" {
+				apiErr.Description = desc
+				break
+			}
+		}
+	} else if text := strings.TrimSpace(string(body)); text != "" && !strings.HasPrefix(text, "<") {
+		apiErr.Description = text
+	}
+
+	if apiErr.Description == "" {
+		apiErr.Description = http.StatusText(resp.StatusCode)
+	}
+
+	return apiErr
+}
+
+// parseRetryAfter accepts both forms of the header: delay seconds or an
+// HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
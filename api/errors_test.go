@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestResponse(status int, body string, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    &http.Request{Method: "POST", URL: &url.URL{Path: "/accounts"}},
+	}
+}
+
+func TestAPIErrorSentinels(t *testing.T) {
+	taken := `{"hydra:description":"address: This value is already used.","violations":[{"propertyPath":"address","message":"This value is already used."}]}`
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		target error
+		want   bool
+	}{
+		{"401 is unauthorized", 401, `{"code":401,"message":"JWT Token not found"}`, ErrUnauthorized, true},
+		{"429 is rate limited", 429, ``, ErrRateLimited, true},
+		{"404 is not found", 404, ``, ErrNotFound, true},
+		{"422 taken address", 422, taken, ErrAddressTaken, true},
+		{"422 other violation", 422, `{"violations":[{"propertyPath":"password","message":"Too short."}]}`, ErrAddressTaken, false},
+		{"422 bad domain", 422, `{"violations":[{"propertyPath":"address","message":"The domain of this address is not available."}]}`, ErrDomainRejected, true},
+		{"422 taken is not a bad domain", 422, taken, ErrDomainRejected, false},
+		{"500 is not rate limited", 500, ``, ErrRateLimited, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := error(newAPIError(newTestResponse(tt.status, tt.body, nil)))
+			if got := errors.Is(err, tt.target); got != tt.want {
+				t.Errorf("errors.Is(%v, %v) = %v, want %v", err, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIErrorDescription(t *testing.T) {
+	err := newAPIError(newTestResponse(401, `{"code":401,"message":"JWT Token not found"}`, nil))
+
+	if err.Description != "JWT Token not found" {
+		t.Errorf("Description = %q, want %q", err.Description, "JWT Token not found")
+	}
+	if want := "POST /accounts: status 401: JWT Token not found"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestAPIErrorRetryAfter(t *testing.T) {
+	header := http.Header{}
+	header.Set("Retry-After", "7")
+
+	err := newAPIError(newTestResponse(429, ``, header))
+	if err.RetryAfter != 7*time.Second {
+		t.Errorf("RetryAfter = %v, want 7s", err.RetryAfter)
+	}
+}
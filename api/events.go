@@ -0,0 +1,252 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMercureURL is the Mercure hub mail.tm publishes account events on.
+const DefaultMercureURL = "https://mercure.mail.tm/.well-known/mercure"
+
+const (
+	sseRetryDelay     = 1 * time.Second
+	sseMaxRetryDelay  = 30 * time.Second
+	sseMaxReconnects  = 5
+	sseEventBuffer    = 16
+	sseMaxEventLength = 1024 * 1024
+)
+
+// mercureURLs maps API base URLs to their hub when it is not served by the
+// API itself under /.well-known/mercure.
+var mercureURLs = map[string]string{
+	DefaultBaseURL: DefaultMercureURL,
+}
+
+// MessageEvent is a message created or updated on the account, as pushed by
+// the Mercure hub. ID is the SSE event id.
+type MessageEvent struct {
+	ID      string
+	Message Message
+}
+
+type sseEvent struct {
+	id    string
+	data  string
+	retry time.Duration
+}
+
+// SetMercureURL overrides the hub used by Subscribe.
+func (c *Client) SetMercureURL(mercureURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mercureURL = mercureURL
+}
+
+// MercureURL returns the hub used by Subscribe.
+func (c *Client) MercureURL() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.mercureURL != "" {
+		return c.mercureURL
+	}
+	if hub, ok := mercureURLs[c.baseURL]; ok {
+		return hub
+	}
+	return c.baseURL + "/.well-known/mercure"
+}
+
+// Subscribe streams message events for the account until ctx is cancelled.
+// The first connection is made before returning, so an error means push is
+// unavailable. Dropped connections are resumed with Last-Event-ID; the
+// channel is closed once ctx ends or the hub stays unreachable.
+func (c *Client) Subscribe(ctx context.Context, accountID string) (<-chan MessageEvent, error) {
+	resp, err := c.connectEvents(ctx, accountID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan MessageEvent, sseEventBuffer)
+	go func() {
+		defer close(events)
+
+		lastID := ""
+		baseDelay := sseRetryDelay
+		failures := 0
+		for {
+			received, retry := c.readEvents(ctx, resp.Body, events, &lastID)
+			_ = resp.Body.Close()
+			if retry > 0 {
+				baseDelay = retry
+			}
+			if received {
+				failures = 0
+			}
+
+			delay := baseDelay
+			for {
+				if ctx.Err() != nil {
+					return
+				}
+
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return
+				}
+
+				resp, err = c.connectEvents(ctx, accountID, lastID)
+				if err == nil {
+					break
+				}
+
+				failures++
+				if failures >= sseMaxReconnects {
+					return
+				}
+				delay = min(delay*2, sseMaxRetryDelay)
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// connectEvents opens the event stream, logging in again once if the hub
+// rejects the token.
+func (c *Client) connectEvents(ctx context.Context, accountID, lastEventID string) (*http.Response, error) {
+	resp, err := c.openEvents(ctx, accountID, lastEventID)
+	if errors.Is(err, ErrUnauthorized) && c.hasCredentials() {
+		if refreshErr := c.refreshToken(ctx, c.GetToken()); refreshErr == nil {
+			return c.openEvents(ctx, accountID, lastEventID)
+		}
+	}
+	return resp, err
+}
+
+func (c *Client) openEvents(ctx context.Context, accountID, lastEventID string) (*http.Response, error) {
+	hub, err := url.Parse(c.MercureURL())
+	if err != nil {
+		return nil, err
+	}
+	query := hub.Query()
+	query.Set("topic", "/accounts/"+accountID)
+	hub.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", hub.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Authorization", "Bearer "+c.GetToken())
+	c.setUserAgent(req)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	// The stream stays open indefinitely, so it cannot share the request
+	// timeout of HTTPClient.
+	resp, err := c.send(c.streamClient(), req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer func() { _ = resp.Body.Close() }()
+		return nil, newAPIError(resp)
+	}
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		_ = resp.Body.Close()
+		return nil, errors.New("event hub did not return an event stream")
+	}
+
+	return resp, nil
+}
+
+// readEvents forwards message events from one connection until it ends. It
+// reports whether any event arrived and the last retry delay the hub asked for.
+func (c *Client) readEvents(ctx context.Context, body io.Reader, events chan<- MessageEvent, lastID *string) (bool, time.Duration) {
+	received := false
+	var retry time.Duration
+
+	parseEvents(body, func(ev sseEvent) bool {
+		if ev.retry > 0 {
+			retry = ev.retry
+		}
+		if ev.id != "" {
+			*lastID = ev.id
+		}
+		if ev.data == "" {
+			return true
+		}
+
+		var payload struct {
+			Type string `json:"@type"`
+			Message
+		}
+		if err := json.Unmarshal([]byte(ev.data), &payload); err != nil {
+			return true
+		}
+		if payload.Type != "" && payload.Type != "Message" {
+			return true
+		}
+
+		received = true
+		select {
+		case events <- MessageEvent{ID: ev.id, Message: payload.Message}:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+
+	return received, retry
+}
+
+// parseEvents reads a text/event-stream body and calls fn for every
+// dispatched event until the body ends or fn returns false.
+func parseEvents(body io.Reader, fn func(sseEvent) bool) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), sseMaxEventLength)
+
+	var ev sseEvent
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" {
+			ev.data = strings.Join(data, "\n")
+			if (ev.data != "" || ev.id != "" || ev.retry > 0) && !fn(ev) {
+				return
+			}
+			ev, data = sseEvent{}, nil
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			ev.id = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms > 0 {
+				ev.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseEvents(t *testing.T) {
+	stream := ": heartbeat\n\nid: 1\nretry: 250\ndata: {\"a\":\ndata: 1}\n\nid: 2\ndata: x\n\n"
+
+	var got []sseEvent
+	parseEvents(strings.NewReader(stream), func(ev sseEvent) bool {
+		got = append(got, ev)
+		return true
+	})
+
+	if len(got) != 2 {
+		t.Fatalf("parsed %d events, want 2", len(got))
+	}
+	if got[0].id != "1" || got[0].data != "{\"a\":\n1}" || got[0].retry != 250*time.Millisecond {
+		t.Errorf("first event = %+v", got[0])
+	}
+	if got[1].id != "2" || got[1].data != "x" {
+		t.Errorf("second event = %+v", got[1])
+	}
+}
+
+func TestSubscribeResumesWithLastEventID(t *testing.T) {
+	var mu sync.Mutex
+	var lastEventIDs []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("topic") != "/accounts/acc-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		conn := len(lastEventIDs)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		if conn == 1 {
+			_, _ = fmt.Fprint(w, "retry: 10\n\n")
+			_, _ = fmt.Fprint(w, "id: ev-1\ndata: {\"@type\":\"Account\",\"id\":\"acc-1\"}\n\n")
+			_, _ = fmt.Fprint(w, "id: ev-2\ndata: {\"@type\":\"Message\",\"id\":\"msg-1\",\"subject\":\"Hello\"}\n\n")
+			return
+		}
+		_, _ = fmt.Fprint(w, "id: ev-3\ndata: {\"@type\":\"Message\",\"id\":\"msg-2\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	client := newTestClient(srv.URL)
+	client.SetMercureURL(srv.URL + "/.well-known/mercure")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events, err := client.Subscribe(ctx, "acc-1")
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	first := <-events
+	if first.Message.ID != "msg-1" || first.Message.Subject != "Hello" {
+		t.Errorf("first event = %+v, want msg-1", first)
+	}
+
+	second := <-events
+	if second.Message.ID != "msg-2" {
+		t.Errorf("second event = %+v, want msg-2", second)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lastEventIDs) != 2 || lastEventIDs[1] != "ev-2" {
+		t.Errorf("Last-Event-ID headers = %q, want reconnect with ev-2", lastEventIDs)
+	}
+}
+
+func TestSubscribeUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	client := newTestClient(srv.URL)
+
+	if _, err := client.Subscribe(context.Background(), "acc-1"); err == nil {
+		t.Error("Subscribe should fail when the hub is missing")
+	}
+}
@@ -0,0 +1,264 @@
+package api_test
+
+import (
+	"burnmail/api"
+	"burnmail/api/apitest"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMailboxLifecycle(t *testing.T) {
+	srv := apitest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := srv.Client()
+
+	domains, err := client.GetDomains(ctx)
+	if err != nil || len(domains) == 0 {
+		t.Fatalf("GetDomains() = %v, %v", domains, err)
+	}
+
+	address := "alice@" + domains[0].Domain
+	account, err := client.CreateAccount(ctx, address, "secret123")
+	if err != nil {
+		t.Fatalf("CreateAccount failed: %v", err)
+	}
+	if _, err := client.CreateAccount(ctx, address, "secret123"); !errors.Is(err, api.ErrAddressTaken) {
+		t.Errorf("second CreateAccount error = %v, want ErrAddressTaken", err)
+	}
+	if _, err := client.Login(ctx, address, "secret123"); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	id, err := srv.Deliver(address, apitest.Message{
+		From:        api.From{Address: "bob@example.org", Name: "Bob"},
+		Subject:     "Report",
+		Text:        "See attached.",
+		Attachments: []apitest.Attachment{{Filename: "report.txt", ContentType: "text/plain", Data: []byte("numbers")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := client.GetMessages(ctx)
+	if err != nil || len(messages) != 1 || messages[0].ID != id {
+		t.Fatalf("GetMessages() = %+v, %v", messages, err)
+	}
+
+	detail, err := client.GetMessage(ctx, id)
+	if err != nil {
+		t.Fatalf("GetMessage failed: %v", err)
+	}
+	if detail.Subject != "Report" || len(detail.Attachments) != 1 {
+		t.Fatalf("GetMessage() = %+v", detail)
+	}
+
+	var buf bytes.Buffer
+	if _, err := client.DownloadAttachmentTo(ctx, id, detail.Attachments[0].ID, &buf, nil); err != nil || buf.String() != "numbers" {
+		t.Errorf("DownloadAttachmentTo() = %q, %v", buf.String(), err)
+	}
+
+	source, err := client.GetMessageSource(ctx, id)
+	if err != nil || !strings.Contains(string(source), "Subject: Report") {
+		t.Errorf("GetMessageSource() = %q, %v", source, err)
+	}
+
+	if err := client.MarkMessageAsRead(ctx, id); err != nil {
+		t.Fatalf("MarkMessageAsRead failed: %v", err)
+	}
+	if detail, _ := client.GetMessage(ctx, id); !detail.Seen {
+		t.Error("message should be seen after MarkMessageAsRead")
+	}
+
+	unseen, flagged := false, true
+	if err := client.UpdateMessage(ctx, id, &unseen, &flagged); err != nil {
+		t.Fatalf("UpdateMessage failed: %v", err)
+	}
+	if messages, _ := client.GetMessages(ctx); messages[0].Seen || !messages[0].Flagged {
+		t.Errorf("after UpdateMessage seen = %v, flagged = %v; want unread and flagged", messages[0].Seen, messages[0].Flagged)
+	}
+	if err := client.UpdateMessage(ctx, id, nil, nil); err != nil {
+		t.Errorf("empty UpdateMessage failed: %v", err)
+	}
+	if detail, _ := client.GetMessage(ctx, id); detail.Seen || !detail.Flagged {
+		t.Error("an empty patch should leave the message unchanged")
+	}
+
+	me, err := client.GetMe(ctx)
+	if err != nil || me.ID != account.ID || me.Used == 0 {
+		t.Errorf("GetMe() = %+v, %v", me, err)
+	}
+
+	if err := client.DeleteMessage(ctx, id); err != nil {
+		t.Fatalf("DeleteMessage failed: %v", err)
+	}
+	if _, err := client.GetMessage(ctx, id); !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("GetMessage after delete error = %v, want ErrNotFound", err)
+	}
+
+	if err := client.DeleteAccount(ctx, account.ID); err != nil {
+		t.Fatalf("DeleteAccount failed: %v", err)
+	}
+	if _, err := client.GetMe(ctx); !errors.Is(err, api.ErrUnauthorized) {
+		t.Errorf("GetMe after delete error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestExpiredTokenIsRenewed(t *testing.T) {
+	srv := apitest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	address := "carol@" + apitest.DefaultDomain
+	srv.AddAccount(address, "secret123")
+
+	client := srv.Client()
+	client.SetCredentials(address, "secret123")
+	if _, err := client.Login(ctx, address, "secret123"); err != nil {
+		t.Fatal(err)
+	}
+
+	var renewed string
+	client.OnTokenRefresh(func(token string) { renewed = token })
+
+	srv.ExpireTokens()
+	if _, err := client.GetMessages(ctx); err != nil {
+		t.Fatalf("GetMessages with expired token failed: %v", err)
+	}
+	if renewed == "" || renewed != client.GetToken() {
+		t.Errorf("OnTokenRefresh got %q, client has %q", renewed, client.GetToken())
+	}
+}
+
+func TestTokenRenewedBeforeExpiry(t *testing.T) {
+	srv := apitest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	address := "dave@" + apitest.DefaultDomain
+	srv.AddAccount(address, "secret123")
+
+	client := srv.Client()
+	client.SetCredentials(address, "secret123")
+	srv.SetTokenTTL(time.Minute)
+	old, err := client.Login(ctx, address, "secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until := time.Until(client.TokenExpiresAt()); until <= 0 || until > time.Minute {
+		t.Fatalf("TokenExpiresAt() is %v away, want within a minute", until)
+	}
+
+	srv.SetTokenTTL(apitest.DefaultTokenTTL)
+	if _, err := client.GetMessages(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if client.GetToken() == old {
+		t.Fatal("a token about to expire should be replaced before the request")
+	}
+
+	requests := srv.Requests()
+	want := []string{"POST /token", "POST /token", "GET /messages"}
+	if strings.Join(requests, ",") != strings.Join(want, ",") {
+		t.Errorf("requests = %v, want %v with no rejected attempt", requests, want)
+	}
+}
+
+func TestInjectedFaults(t *testing.T) {
+	srv := apitest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := srv.Client()
+
+	srv.Inject(apitest.Fault{Path: "/domains", Status: http.StatusInternalServerError})
+	var apiErr *api.APIError
+	if _, err := client.GetDomains(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("GetDomains() error = %v, want a 500 APIError", err)
+	}
+	if _, err := client.GetDomains(ctx); err != nil {
+		t.Errorf("fault should clear after one request, got %v", err)
+	}
+
+	srv.Inject(apitest.Fault{Method: "GET", Path: "/domains", Status: http.StatusTooManyRequests, RetryAfter: time.Second})
+	if _, err := client.GetDomains(ctx); !errors.Is(err, api.ErrRateLimited) {
+		t.Fatalf("GetDomains() error = %v, want ErrRateLimited", err)
+	}
+	if !client.RateLimitState().Limited() {
+		t.Error("client should back off after the injected 429")
+	}
+
+	start := time.Now()
+	if _, err := client.GetDomains(ctx); err != nil {
+		t.Fatalf("GetDomains after back-off failed: %v", err)
+	}
+	if waited := time.Since(start); waited < 500*time.Millisecond {
+		t.Errorf("request after 429 went out after %v, want it held back about 1s", waited)
+	}
+}
+
+func TestSubscribeReceivesDeliveredMail(t *testing.T) {
+	srv := apitest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	address := "dave@" + apitest.DefaultDomain
+	account := srv.AddAccount(address, "secret123")
+
+	client := srv.Client()
+	if _, err := client.Login(ctx, address, "secret123"); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := client.Subscribe(ctx, account.ID)
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	id, err := srv.Deliver(address, apitest.Message{Subject: "Live"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Message.ID != id || ev.Message.Subject != "Live" {
+			t.Errorf("event = %+v, want message %s", ev, id)
+		}
+	case <-ctx.Done():
+		t.Fatal("no event received for the delivered message")
+	}
+}
+
+func TestGetMessageSource(t *testing.T) {
+	for _, linked := range []bool{false, true} {
+		srv := apitest.NewServer()
+		if linked {
+			srv.LinkSources()
+		}
+
+		srv.AddAccount("me@"+apitest.DefaultDomain, "secret")
+		id, err := srv.Deliver("me@"+apitest.DefaultDomain, apitest.Message{Subject: "DKIM check", Text: "body"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := srv.Client()
+		if _, err := client.Login(context.Background(), "me@"+apitest.DefaultDomain, "secret"); err != nil {
+			t.Fatal(err)
+		}
+
+		source, err := client.GetMessageSource(context.Background(), id)
+		if err != nil || !strings.Contains(string(source), "Subject: DKIM check\r\n") {
+			t.Errorf("linked %v: GetMessageSource() = %q, %v; want the raw message", linked, source, err)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// Option configures a Client built by NewClient.
+type Option func(*Client)
+
+// WithBaseURL points the client at another Hydra-compatible API.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithHTTPClient replaces the HTTP client. Its transport is also used for
+// streams, without the timeout.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.HTTPClient = httpClient
+	}
+}
+
+// WithTransport keeps the default HTTP client but sends requests through
+// rt, typically one built by NewTransport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		httpClient := *c.HTTPClient
+		httpClient.Transport = rt
+		c.HTTPClient = &httpClient
+	}
+}
+
+// WithRateLimit gives the client its own rate limiter, sending perSecond
+// requests per second with bursts of up to burst requests. A rate that is
+// not a positive number keeps the shared limiter.
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(c *Client) {
+		if !(perSecond > 0) || math.IsInf(perSecond, 1) {
+			return
+		}
+		c.limiter = newRateLimiter(perSecond, max(burst, 1))
+	}
+}
+
+// WithToken starts the client logged in with an existing token.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithLogger logs every request, its latency, rate limiter wait and
+// truncated bodies to logger at debug level, with secrets redacted.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
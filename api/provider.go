@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Provider is the set of operations burnmail needs from a disposable mail
+// service. Client implements it for mail.tm and any other service exposing
+// the same Hydra API.
+type Provider interface {
+	GetDomains(ctx context.Context) ([]Domain, error)
+	CreateAccount(ctx context.Context, address, password string) (*Account, error)
+	Login(ctx context.Context, address, password string) (string, error)
+	GetAccount(ctx context.Context, accountID string) (*Account, error)
+	GetMe(ctx context.Context) (*Account, error)
+	DeleteAccount(ctx context.Context, accountID string) error
+	GetMessages(ctx context.Context) ([]Message, error)
+	GetMessagesPage(ctx context.Context, page int) (*MessagesPage, error)
+	GetAllMessages(ctx context.Context) ([]Message, error)
+	GetMessage(ctx context.Context, id string) (*MessageDetail, error)
+	GetMessageSource(ctx context.Context, id string) ([]byte, error)
+	DeleteMessage(ctx context.Context, id string) error
+	MarkMessageAsRead(ctx context.Context, id string) error
+	UpdateMessage(ctx context.Context, id string, seen, flagged *bool) error
+	DownloadAttachment(ctx context.Context, messageID, attachmentID string) ([]byte, error)
+	DownloadAttachmentTo(ctx context.Context, messageID, attachmentID string, w io.Writer, progress ProgressFunc) (int64, error)
+	Subscribe(ctx context.Context, accountID string) (<-chan MessageEvent, error)
+	SetToken(token string)
+	GetToken() string
+}
+
+var _ Provider = (*Client)(nil)
+
+const DefaultProvider = "mailtm"
+
+// providers maps the names accepted by --provider to their API base URL.
+var providers = map[string]string{
+	"mailtm": DefaultBaseURL,
+	"mailgw": "https://api.mail.gw",
+}
+
+// ProviderNames returns the known provider names in sorted order.
+func ProviderNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveBaseURL picks the API base URL for a provider name or an explicit
+// URL. An explicit URL wins; an empty provider means DefaultProvider.
+func ResolveBaseURL(provider, apiURL string) (string, error) {
+	if apiURL != "" {
+		u, err := url.Parse(apiURL)
+		if err != nil {
+			return "", fmt.Errorf("invalid API URL %q: %v", apiURL, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", fmt.Errorf("invalid API URL %q: must be an http(s) URL", apiURL)
+		}
+		return strings.TrimSuffix(apiURL, "/"), nil
+	}
+
+	if provider == "" {
+		provider = DefaultProvider
+	}
+
+	baseURL, ok := providers[strings.ToLower(provider)]
+	if !ok {
+		return "", fmt.Errorf("unknown provider %q (available: %s)", provider, strings.Join(ProviderNames(), ", "))
+	}
+	return baseURL, nil
+}
+
+// ProviderSetting is a provider name or API URL from one source of
+// settings, such as the flags or the config file.
+type ProviderSetting struct {
+	Provider string
+	APIURL   string
+}
+
+// ResolveFirst resolves the first setting that names a provider or an API
+// URL, so callers list their sources in order of precedence. When none
+// does, it resolves DefaultProvider.
+func ResolveFirst(settings ...ProviderSetting) (string, error) {
+	for _, s := range settings {
+		if s.Provider != "" || s.APIURL != "" {
+			return ResolveBaseURL(s.Provider, s.APIURL)
+		}
+	}
+	return ResolveBaseURL("", "")
+}
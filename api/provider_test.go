@@ -0,0 +1,57 @@
+package api
+
+import "testing"
+
+func TestResolveBaseURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		apiURL   string
+		want     string
+		wantErr  bool
+	}{
+		{"default provider", "", "", DefaultBaseURL, false},
+		{"known provider", "mailgw", "", "https://api.mail.gw", false},
+		{"provider names ignore case", "MailTM", "", DefaultBaseURL, false},
+		{"unknown provider", "gmail", "", "", true},
+		{"URL wins over provider", "mailgw", "http://localhost:8080/", "http://localhost:8080", false},
+		{"URL without scheme", "", "localhost:8080", "", true},
+		{"URL with another scheme", "", "ftp://example.com", "", true},
+		{"URL without host", "", "https://", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveBaseURL(tt.provider, tt.apiURL)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: ResolveBaseURL(%q, %q) = %q, %v; want %q, error %v", tt.name, tt.provider, tt.apiURL, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestResolveFirst(t *testing.T) {
+	flags := ProviderSetting{Provider: "mailgw"}
+	saved := ProviderSetting{APIURL: "http://saved.test"}
+	config := ProviderSetting{APIURL: "http://config.test"}
+
+	tests := []struct {
+		name     string
+		settings []ProviderSetting
+		want     string
+	}{
+		{"flags win", []ProviderSetting{flags, saved, config}, "https://api.mail.gw"},
+		{"then the saved account", []ProviderSetting{{}, saved, config}, "http://saved.test"},
+		{"then the config file", []ProviderSetting{{}, {}, config}, "http://config.test"},
+		{"nothing set", []ProviderSetting{{}, {}, {}}, DefaultBaseURL},
+	}
+
+	for _, tt := range tests {
+		if got, err := ResolveFirst(tt.settings...); err != nil || got != tt.want {
+			t.Errorf("%s: ResolveFirst() = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	// A bad setting is reported, not skipped for the next one.
+	if _, err := ResolveFirst(ProviderSetting{Provider: "gmail"}, config); err == nil {
+		t.Error("ResolveFirst() should fail on an unknown provider instead of falling through")
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateLimit   = 5.0
+	defaultRateBurst   = 5
+	rateLimitBaseDelay = 1 * time.Second
+	rateLimitMaxDelay  = 60 * time.Second
+)
+
+// RateLimitState is a snapshot of the client-side rate limiter.
+type RateLimitState struct {
+	Tokens   float64
+	Capacity int
+	// ResumeAt is set while the server has asked the client to back off.
+	ResumeAt time.Time
+}
+
+// Limited reports whether requests are currently held back by a 429.
+func (s RateLimitState) Limited() bool {
+	return time.Now().Before(s.ResumeAt)
+}
+
+// rateLimiter is a token bucket shared by every request of a Client. A 429
+// pauses the whole bucket, for Retry-After if the server sent one and
+// otherwise for a delay that doubles with each consecutive 429.
+type rateLimiter struct {
+	mu          sync.Mutex
+	rate        float64
+	capacity    float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	strikes     int
+}
+
+// sharedLimiter is the rate limiter of every client without WithRateLimit.
+var sharedLimiter = newRateLimiter(defaultRateLimit, defaultRateBurst)
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:     rate,
+		capacity: float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+func (l *rateLimiter) refill(now time.Time) {
+	l.tokens = min(l.capacity, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+}
+
+// Wait blocks until a request may be sent and returns how long it waited.
+func (l *rateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.refill(now)
+
+		var delay time.Duration
+		switch {
+		case now.Before(l.pausedUntil):
+			delay = l.pausedUntil.Sub(now)
+		case l.tokens >= 1:
+			l.tokens--
+			l.mu.Unlock()
+			return time.Since(start), nil
+		default:
+			delay = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return time.Since(start), ctx.Err()
+		}
+	}
+}
+
+// OnRateLimited pauses every request after a 429.
+func (l *rateLimiter) OnRateLimited(retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delay := retryAfter
+	if delay <= 0 {
+		delay = min(rateLimitBaseDelay<<l.strikes, rateLimitMaxDelay)
+	}
+	l.strikes = min(l.strikes+1, 6)
+
+	if until := time.Now().Add(delay); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	l.tokens = 0
+}
+
+// OnSuccess resets the back-off after a request went through.
+func (l *rateLimiter) OnSuccess() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.strikes = 0
+}
+
+func (l *rateLimiter) State() RateLimitState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+
+	state := RateLimitState{Tokens: l.tokens, Capacity: int(l.capacity)}
+	if time.Now().Before(l.pausedUntil) {
+		state.ResumeAt = l.pausedUntil
+	}
+	return state
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurstThenWaits(t *testing.T) {
+	limiter := newRateLimiter(20, 2)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if waited, err := limiter.Wait(ctx); err != nil || waited > 10*time.Millisecond {
+			t.Fatalf("request %d within burst waited %v, err %v", i, waited, err)
+		}
+	}
+
+	waited, err := limiter.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if waited < 30*time.Millisecond {
+		t.Errorf("request past the burst waited %v, want about 50ms", waited)
+	}
+}
+
+func TestRateLimiterWaitHonoursContext(t *testing.T) {
+	limiter := newRateLimiter(1, 1)
+	limiter.OnRateLimited(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want deadline exceeded", err)
+	}
+}
+
+func TestRetryAfterPausesClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(srv.URL)
+	if _, err := client.GetDomains(context.Background()); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("GetDomains() error = %v, want ErrRateLimited", err)
+	}
+
+	state := client.RateLimitState()
+	if !state.Limited() {
+		t.Fatal("client should be paused after a 429")
+	}
+	if wait := time.Until(state.ResumeAt); wait < 25*time.Second || wait > 30*time.Second {
+		t.Errorf("resuming in %v, want about 30s", wait)
+	}
+
+	// Every endpoint shares the pause, including unauthenticated ones.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.Login(ctx, "a@b.c", "pw"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Login() error = %v, want it held back until the deadline", err)
+	}
+}
+
+func TestClientsShareRateLimiter(t *testing.T) {
+	if NewClient().limiter != NewClient().limiter {
+		t.Error("clients should share one rate limiter per process")
+	}
+	if own := NewClient(WithRateLimit(10, 2)); own.limiter == sharedLimiter {
+		t.Error("WithRateLimit should give the client its own limiter")
+	}
+
+	for _, rate := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		if c := NewClient(WithRateLimit(rate, 5)); c.limiter != sharedLimiter {
+			t.Errorf("WithRateLimit(%v) should be ignored", rate)
+		}
+	}
+}
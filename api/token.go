@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// tokenRefreshMargin is how long before expiry a token is replaced, so that
+// requests in flight never carry one the server has started rejecting.
+const tokenRefreshMargin = 5 * time.Minute
+
+// TokenExpiry reads the exp claim of a JWT. The signature is not checked;
+// the expiry is only used to decide when to log in again.
+func TokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var claims struct {
+		Exp json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, err
+	}
+	if claims.Exp == "" {
+		return time.Time{}, errors.New("token has no expiry")
+	}
+
+	exp, err := claims.Exp.Float64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(exp), 0), nil
+}
+
+// TokenExpiresAt returns when the current token expires, or the zero time if
+// there is no token or it carries no expiry.
+func (c *Client) TokenExpiresAt() time.Time {
+	exp, err := TokenExpiry(c.GetToken())
+	if err != nil {
+		return time.Time{}
+	}
+	return exp
+}
+
+// refreshIfExpiring logs in again before sending an authenticated request
+// whose token is about to expire. If that fails the request goes out with
+// the old token and the usual 401 handling takes over.
+func (c *Client) refreshIfExpiring(req *http.Request) {
+	auth := req.Header.Get("Authorization")
+	if auth == "" || !c.hasCredentials() {
+		return
+	}
+
+	stale := strings.TrimPrefix(auth, "Bearer ")
+	exp, err := TokenExpiry(stale)
+	if err != nil || time.Until(exp) > tokenRefreshMargin {
+		return
+	}
+
+	if err := c.refreshToken(req.Context(), stale); err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+c.GetToken())
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestTokenExpiry(t *testing.T) {
+	jwt := func(claims string) string {
+		return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".sig"
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"integer exp", jwt(`{"iat":1700000000,"exp":1700003600}`), time.Unix(1700003600, 0), false},
+		{"float exp", jwt(`{"exp":1700003600.0}`), time.Unix(1700003600, 0), false},
+		{"no exp", jwt(`{"iat":1700000000}`), time.Time{}, true},
+		{"not a JWT", "opaque-token", time.Time{}, true},
+		{"bad payload", "a.!!!.c", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TokenExpiry(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TokenExpiry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("TokenExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
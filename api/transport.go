@@ -0,0 +1,97 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// TransportConfig describes how the client reaches the API.
+type TransportConfig struct {
+	// ProxyURL overrides the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	// environment variables. The http, https, socks5 and socks5h schemes
+	// are accepted; socks5h also resolves host names through the proxy,
+	// which is what Tor expects.
+	ProxyURL string
+	// CACertFile is a PEM bundle trusted in addition to the system roots.
+	CACertFile string
+}
+
+// NewTransport builds an HTTP transport for cfg. With an empty config it
+// uses the proxy from the environment and the system roots.
+func NewTransport(cfg TransportConfig) (*http.Transport, error) {
+	transport := newDefaultTransport()
+
+	if cfg.ProxyURL != "" {
+		proxyURL, err := parseProxyURL(cfg.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.CACertFile != "" {
+		pool, err := loadCertPool(cfg.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	return transport, nil
+}
+
+func newDefaultTransport() *http.Transport {
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		DisableKeepAlives:   false,
+		DisableCompression:  false,
+	}
+}
+
+func parseProxyURL(raw string) (*url.URL, error) {
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %v", raw, err)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: scheme must be http, https, socks5 or socks5h", raw)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", raw)
+	}
+
+	return proxyURL, nil
+}
+
+// loadCertPool returns the system roots plus the certificates in path.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+
+	return pool, nil
+}
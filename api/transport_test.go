@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewTransportRejectsBadProxy(t *testing.T) {
+	for _, raw := range []string{"ftp://proxy:21", "socks5://", "://nope"} {
+		if _, err := NewTransport(TransportConfig{ProxyURL: raw}); err == nil {
+			t.Errorf("NewTransport(%q) should fail", raw)
+		}
+	}
+}
+
+func TestNewTransportUsesProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		_, _ = w.Write([]byte(`[{"id":"1","domain":"example.test","isActive":true}]`))
+	}))
+	defer proxy.Close()
+
+	transport, err := NewTransport(TransportConfig{ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(WithBaseURL("http://api.example.invalid"), WithTransport(transport))
+	if _, err := client.GetDomains(context.Background()); err != nil {
+		t.Fatalf("GetDomains through proxy failed: %v", err)
+	}
+	if proxied != "http://api.example.invalid/domains" {
+		t.Errorf("proxy saw %q, want the absolute API URL", proxied)
+	}
+}
+
+func TestNewTransportTrustsCACert(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"id":"1","domain":"example.test","isActive":true}]`))
+	}))
+	defer srv.Close()
+
+	if _, err := NewClient(WithBaseURL(srv.URL)).GetDomains(context.Background()); err == nil {
+		t.Fatal("request to a self-signed server should fail without the CA")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	transport, err := NewTransport(TransportConfig{CACertFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewClient(WithBaseURL(srv.URL), WithTransport(transport)).GetDomains(context.Background()); err != nil {
+		t.Errorf("GetDomains with the CA bundle failed: %v", err)
+	}
+
+	if _, err := NewTransport(TransportConfig{CACertFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("NewTransport should fail for a missing CA bundle")
+	}
+}
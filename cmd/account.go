@@ -4,76 +4,70 @@ import (
 	"burnmail/api"
 	"burnmail/storage"
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"slices"
 	"time"
 
 	"github.com/atotto/clipboard"
 	"github.com/spf13/cobra"
 )
 
-func generateEmail(_ *cobra.Command, _ []string) {
+func generateEmail(cmd *cobra.Command, _ []string) {
+	if ttlFlag < 0 {
+		fmt.Printf("%s --ttl must be positive\n", red("✗"))
+		return
+	}
+
 	if storage.Exists() {
 		existingAccount, _ := storage.Load()
 		if existingAccount != nil {
-			fmt.Printf("%s Account already exists: %s\n", yellow("⚠"), cyan(existingAccount.Address))
-			fmt.Printf("Use '%s' to delete it first.\n", yellow("burnmail d"))
+			fmt.Printf("%s Account already exists in profile %s: %s\n", yellow("⚠"), storage.Profile(), cyan(existingAccount.Address))
+			fmt.Printf("Use '%s' to delete it first, or '%s' for another inbox.\n", yellow(profileArgs("burnmail d")), yellow("burnmail g --profile <name>"))
 			return
 		}
 	}
 
+	client := newClientOrExit(nil)
+	if client == nil {
+		return
+	}
+
 	fmt.Println(cyan("🔍 Fetching available domains..."))
 
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	ctx, cancel := context.WithTimeout(cmd.Context(), requestTimeout)
 	defer cancel()
 
-	client := api.GetClient()
-
 	domains, err := retryWithBackoff(ctx, func() (interface{}, error) {
-		return client.GetDomains()
+		return client.GetDomains(ctx)
 	})
 	if err != nil {
-		fmt.Printf("%s Failed to get domains: %v\n", red("✗"), err)
+		printFailure("get domains", err)
 		return
 	}
 
-	domainList := domains.([]api.Domain)
-	if len(domainList) == 0 {
-		fmt.Printf("%s No domains available\n", red("✗"))
-		return
-	}
-
-	var selectedDomain string
-	for _, d := range domainList {
-		if d.IsActive {
-			selectedDomain = d.Domain
-			break
-		}
-	}
-
-	if selectedDomain == "" {
-		fmt.Printf("%s No active domains found\n", red("✗"))
+	candidates, err := pickDomains(domains.([]api.Domain), domainFlag, randomDomain)
+	if err != nil {
+		fmt.Printf("%s %v\n", red("✗"), err)
 		return
 	}
 
-	username := generateRandomString(8)
-	address := username + "@" + selectedDomain
 	password := generateRandomString(16)
 
 	fmt.Println(cyan("📧 Creating email address..."))
 
-	account, err := retryWithBackoff(ctx, func() (interface{}, error) {
-		return client.CreateAccount(address, password)
-	})
+	address, account, err := createAccount(ctx, client, candidates, password)
 	if err != nil {
-		fmt.Printf("%s Failed to create account: %v\n", red("✗"), err)
+		printFailure("create account", err)
 		return
 	}
 
 	token, err := retryWithBackoff(ctx, func() (interface{}, error) {
-		return client.Login(address, password)
+		return client.Login(ctx, address, password)
 	})
 	if err != nil {
-		fmt.Printf("%s Failed to login: %v\n", red("✗"), err)
+		printFailure("login", err)
 		return
 	}
 
@@ -81,12 +75,23 @@ func generateEmail(_ *cobra.Command, _ []string) {
 		Address:   address,
 		Password:  password,
 		Token:     token.(string),
-		AccountID: account.(*api.Account).ID,
+		AccountID: account.ID,
 		CreatedAt: time.Now().Format("02/01/2006, 15:04:05"),
+		APIURL:    client.BaseURL(),
+	}
+	if ttlFlag > 0 {
+		accountData.ExpiresAt = time.Now().Add(ttlFlag)
 	}
 
-	if err := storage.Save(accountData); err != nil {
-		fmt.Printf("%s Failed to save account: %v\n", red("✗"), err)
+	if err := storage.Create(accountData); err != nil {
+		if errors.Is(err, storage.ErrAccountExists) {
+			// Another burnmail made an account in this profile while we
+			// were creating ours; keep theirs and drop the orphan.
+			_ = client.DeleteAccount(ctx, account.ID)
+			fmt.Printf("%s Another burnmail process created an account in profile %s meanwhile; use '%s' to see it.\n", yellow("⚠"), storage.Profile(), yellow(profileArgs("burnmail me")))
+			return
+		}
+		printFailure("save account", err)
 		return
 	}
 
@@ -98,24 +103,65 @@ func generateEmail(_ *cobra.Command, _ []string) {
 	}
 
 	fmt.Printf("\n%s\n\n", green(address))
+	if !accountData.ExpiresAt.IsZero() {
+		fmt.Printf("Burns in %s, at %s. Expired inboxes are deleted by the next burnmail command or '%s'.\n\n",
+			formatRemaining(ttlFlag), accountData.ExpiresAt.Format("02/01/2006 15:04"), yellow("burnmail gc"))
+	}
+	if profile := storage.Profile(); profile != storage.DefaultProfile && profileFlag != "" {
+		fmt.Printf("Saved in profile %s. Use '%s' to make it the default.\n\n", cyan(profile), yellow("burnmail use "+profile))
+	}
+}
+
+// createAccount registers a random address on the first domain that takes
+// it. A taken username is just bad luck and is drawn again a few times; a
+// domain the server refuses is skipped for the next one.
+func createAccount(ctx context.Context, client api.Provider, domains []string, password string) (string, *api.Account, error) {
+	if len(domains) == 0 {
+		return "", nil, errors.New("no domain to create the address on")
+	}
+
+	var address string
+	var account interface{}
+	var err error
+	for i, domain := range domains {
+		for attempt := 0; attempt < createAccountAttempts; attempt++ {
+			address = generateRandomString(8) + "@" + domain
+			account, err = retryWithBackoff(ctx, func() (interface{}, error) {
+				return client.CreateAccount(ctx, address, password)
+			})
+			if !errors.Is(err, api.ErrAddressTaken) {
+				break
+			}
+		}
+		if !errors.Is(err, api.ErrDomainRejected) || i == len(domains)-1 {
+			break
+		}
+		fmt.Printf("%s Domain %s was rejected, trying %s\n", yellow("⚠"), domain, domains[i+1])
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return address, account.(*api.Account), nil
 }
 
-func deleteAccount(_ *cobra.Command, _ []string) {
+func deleteAccount(cmd *cobra.Command, _ []string) {
 	accountData := loadAccountOrExit()
 	if accountData == nil {
 		return
 	}
 
-	client := api.GetClient()
-	client.SetToken(accountData.Token)
+	client := newClientOrExit(accountData)
+	if client == nil {
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	ctx, cancel := context.WithTimeout(cmd.Context(), requestTimeout)
 	defer cancel()
 
 	_, deleteErr := retryWithBackoff(ctx, func() (interface{}, error) {
-		return nil, client.DeleteAccount(accountData.AccountID)
+		return nil, client.DeleteAccount(ctx, accountData.AccountID)
 	})
-	if deleteErr != nil {
+	if deleteErr != nil && !errors.Is(deleteErr, api.ErrNotFound) {
 		fmt.Printf("%s Failed to delete account from server: %v\n", yellow("⚠"), deleteErr)
 	}
 
@@ -123,16 +169,84 @@ func deleteAccount(_ *cobra.Command, _ []string) {
 		fmt.Printf("%s Failed to delete local data: %v\n", red("✗"), err)
 		return
 	}
+	forgetProfile(storage.Profile())
 
 	fmt.Printf("%s Account deleted successfully\n", green("✓"))
+	if archived, _ := storage.ListArchives(storage.Profile()); slices.Contains(archived, accountData.AccountID) {
+		fmt.Fprintf(os.Stderr, "%s Its archived mail is kept; remove it with '%s'\n", cyan("→"), yellow(profileArgs("burnmail archive purge "+accountData.Address)))
+	}
 }
 
-func showAccount(_ *cobra.Command, _ []string) {
+func showAccount(cmd *cobra.Command, _ []string) {
 	accountData := loadAccountOrExit()
 	if accountData == nil {
 		return
 	}
 
 	fmt.Printf("\n%s: %s\n", cyan("Email"), accountData.Address)
-	fmt.Printf("%s: %s\n\n", cyan("Created At"), accountData.CreatedAt)
+	fmt.Printf("%s: %s\n", cyan("Created At"), accountData.CreatedAt)
+	if accountData.Protection == storage.ProtectionPlaintext {
+		fmt.Printf("%s: %s\n", cyan("Protection"), red(protectionLabel(accountData.Protection)))
+	} else {
+		fmt.Printf("%s: %s\n", cyan("Protection"), green(protectionLabel(accountData.Protection)))
+	}
+	if notice := expiryNotice(accountData); notice != "" {
+		expires := accountData.ExpiresAt.Local().Format("02/01/2006 15:04")
+		if accountData.Expired(time.Now()) {
+			fmt.Printf("%s: %s (%s)\n", cyan("Expires"), red(notice), expires)
+		} else {
+			fmt.Printf("%s: %s (%s)\n", cyan("Expires"), yellow(notice), expires)
+		}
+	}
+
+	client := newClientOrExit(accountData)
+	if client == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), requestTimeout)
+	defer cancel()
+
+	savedToken := accountData.Token
+	result, err := retryWithBackoff(ctx, func() (interface{}, error) {
+		return client.GetMe(ctx)
+	})
+	if err != nil {
+		if errors.Is(err, api.ErrUnauthorized) {
+			fmt.Printf("%s: %s\n", cyan("Token"), red("rejected"))
+		}
+		fmt.Println()
+		printFailure("fetch account from server", err)
+		return
+	}
+	account := result.(*api.Account)
+
+	fmt.Printf("%s: %s\n", cyan("Status"), accountStatus(account))
+	if usage := account.QuotaUsage(); usage >= 0 {
+		fmt.Printf("%s: %s of %s (%.0f%%)\n", cyan("Storage"), formatBytes(account.Used), formatBytes(account.Quota), usage*100)
+	}
+	token := green("valid")
+	if client.GetToken() != savedToken {
+		token = yellow("renewed with the saved password")
+	}
+	if expiry := tokenExpiry(client); expiry != "" {
+		token += ", " + expiry
+	}
+	fmt.Printf("%s: %s\n", cyan("Token"), token)
+	fmt.Println()
+
+	if account.QuotaUsage() >= quotaWarningThreshold {
+		fmt.Printf("%s Mailbox is nearly full; delete messages to keep receiving mail.\n\n", yellow("⚠"))
+	}
+}
+
+// accountStatus describes whether the server still accepts mail for account
+func accountStatus(account *api.Account) string {
+	switch {
+	case account.IsDeleted:
+		return red("deleted")
+	case account.IsDisabled:
+		return red("disabled")
+	}
+	return green("active")
 }
@@ -0,0 +1,629 @@
+package cmd
+
+import (
+	"burnmail/api"
+	"burnmail/storage"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Kinds of records in the archive
+const (
+	archivedMessages    = "messages"
+	archivedSources     = "sources"
+	archivedAttachments = "attachments"
+)
+
+// errOffline is returned for anything that needs the server with --offline.
+var errOffline = errors.New("not available offline")
+
+// errNotArchived wraps api.ErrNotFound, so callers treat it like a message
+// the server no longer has.
+var errNotArchived = fmt.Errorf("%w in the archive", api.ErrNotFound)
+
+// mailbox is what reading mail needs: the API client, or the archive alone
+// with --offline.
+type mailbox interface {
+	api.Provider
+	RateLimitState() api.RateLimitState
+	TokenExpiresAt() time.Time
+}
+
+// openMailboxOrExit returns where to read mail from. Online, every message
+// read through it is archived too, unless the config turns that off.
+func openMailboxOrExit(accountData *storage.AccountData) mailbox {
+	if offlineFlag {
+		archive, err := openArchive(accountData)
+		if err != nil {
+			fmt.Printf("%s Failed to open the archive: %v\n", red("✗"), err)
+			return nil
+		}
+		return &offlineMailbox{archive: archive}
+	}
+
+	client := newClientOrExit(accountData)
+	if client == nil {
+		return nil
+	}
+	if archiveSettings().Disabled {
+		return client
+	}
+
+	archive, err := openArchive(accountData)
+	if err != nil {
+		// The archive is never written in the clear, so with plaintext
+		// accounts there is simply none.
+		if !errors.Is(err, storage.ErrNoProtection) {
+			fmt.Fprintf(os.Stderr, "%s Messages are not archived: %v\n", yellow("⚠"), err)
+		}
+		return client
+	}
+	// Remember whose mail it is, for reading it once the account is gone.
+	if _, err := archive.Info(); os.IsNotExist(err) {
+		_ = archive.SetInfo(&storage.ArchiveInfo{
+			AccountID: accountData.AccountID,
+			Address:   accountData.Address,
+			CreatedAt: accountData.CreatedAt,
+		})
+	}
+	return &archivingMailbox{mailbox: client, archive: archive}
+}
+
+// mailAccountOrExit returns the account whose mail is read: the one of the
+// profile or, with --offline, the one of the archive picked by --archive,
+// which may be gone everywhere else.
+func mailAccountOrExit() *storage.AccountData {
+	if !offlineFlag {
+		return loadAccountOrExit()
+	}
+
+	profile := storage.Profile()
+	archived, err := archivedAccounts(profile)
+	if err != nil {
+		fmt.Printf("%s Failed to open the archive: %v\n", red("✗"), err)
+		return nil
+	}
+
+	// Without --archive, the archive of the current account, or the only
+	// one there is.
+	want := archiveFlag
+	live, _ := storage.Load()
+	if want == "" && live != nil {
+		want = live.AccountID
+	} else if want == "" && len(archived) == 1 {
+		want = archived[0].AccountID
+	}
+
+	for _, a := range archived {
+		if want == "" || (a.AccountID != want && a.Address != want) {
+			continue
+		}
+		if live != nil && live.AccountID == a.AccountID {
+			return live
+		}
+		return &storage.AccountData{Address: a.Address, AccountID: a.AccountID, CreatedAt: a.CreatedAt}
+	}
+
+	switch {
+	case len(archived) == 0:
+		fmt.Printf("%s No archived mail in profile %s. Mail is archived as it is read online.\n", red("✗"), profile)
+	case live != nil && want == live.AccountID:
+		fmt.Printf("%s Nothing archived yet for %s. Mail is archived as it is read online.\n", red("✗"), live.Address)
+	case want != "":
+		fmt.Printf("%s No archive of %s in profile %s. See '%s'\n", red("✗"), want, profile, yellow("burnmail archive ls"))
+	default:
+		fmt.Printf("%s Profile %s holds %d archives; pick one with --archive. See '%s'\n", red("✗"), profile, len(archived), yellow("burnmail archive ls"))
+	}
+	return nil
+}
+
+// archivedAccount is what an archive knows of its account.
+type archivedAccount struct {
+	storage.ArchiveInfo
+	messages int
+}
+
+// archivedAccounts opens every archive of a profile. An archive that never
+// recorded its account is known by its account ID alone.
+func archivedAccounts(profile string) ([]archivedAccount, error) {
+	ids, err := storage.ListArchives(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	archived := make([]archivedAccount, 0, len(ids))
+	for _, id := range ids {
+		archive, err := storage.OpenArchive(profile, id)
+		if err != nil {
+			return nil, err
+		}
+
+		a := archivedAccount{ArchiveInfo: storage.ArchiveInfo{AccountID: id}}
+		if info, err := archive.Info(); err == nil {
+			a.ArchiveInfo = *info
+		}
+		if messages, err := archive.List(archivedMessages); err == nil {
+			a.messages = len(messages)
+		}
+		archived = append(archived, a)
+	}
+	return archived, nil
+}
+
+func listArchives(_ *cobra.Command, _ []string) {
+	profiles, err := storage.ArchiveProfiles()
+	if err != nil {
+		fmt.Printf("%s Failed to list archives: %v\n", red("✗"), err)
+		return
+	}
+	if len(profiles) == 0 {
+		fmt.Printf("%s Nothing archived yet. Mail is archived as it is read.\n", yellow("⚠"))
+		return
+	}
+
+	fmt.Println()
+	for _, name := range profiles {
+		archived, err := archivedAccounts(name)
+		if err != nil {
+			fmt.Printf("  %-16s %s\n", name, red("unreadable: "+err.Error()))
+			continue
+		}
+
+		var liveID string
+		if account, err := storage.LoadProfile(name); err == nil && account != nil {
+			liveID = account.AccountID
+		}
+		for _, a := range archived {
+			status := yellow("account gone")
+			if a.AccountID == liveID {
+				status = green("current account")
+			}
+			msgWord := "messages"
+			if a.messages == 1 {
+				msgWord = "message"
+			}
+			fmt.Printf("  %-16s %s  %d %s  %s\n", name, cyan(cmp.Or(a.Address, a.AccountID)), a.messages, msgWord, status)
+		}
+	}
+	fmt.Printf("\nRead one with '%s'.\n\n", yellow("burnmail m --offline --profile <name> --archive <address>"))
+}
+
+func purgeArchives(_ *cobra.Command, args []string) {
+	if len(args) == 0 && !purgeAll {
+		fmt.Printf("%s Name the archives to purge, or pass --all. See '%s'\n", red("✗"), yellow("burnmail archive ls"))
+		return
+	}
+
+	profile := storage.Profile()
+	archived, err := archivedAccounts(profile)
+	if err != nil {
+		fmt.Printf("%s Failed to open the archive: %v\n", red("✗"), err)
+		return
+	}
+
+	for _, want := range args {
+		if !slices.ContainsFunc(archived, func(a archivedAccount) bool { return a.AccountID == want || a.Address == want }) {
+			fmt.Printf("%s No archive of %s in profile %s\n", red("✗"), want, profile)
+			return
+		}
+	}
+
+	for _, a := range archived {
+		if !purgeAll && !slices.Contains(args, a.AccountID) && !slices.Contains(args, a.Address) {
+			continue
+		}
+		if err := storage.PurgeArchive(profile, a.AccountID); err != nil {
+			fmt.Printf("%s Failed to purge the archive of %s: %v\n", red("✗"), cmp.Or(a.Address, a.AccountID), err)
+			return
+		}
+		fmt.Printf("%s Purged the archive of %s\n", green("✓"), cmp.Or(a.Address, a.AccountID))
+	}
+}
+
+func archiveSettings() storage.ArchiveConfig {
+	cfg, err := storage.LoadConfig()
+	if err != nil || cfg.Archive == nil {
+		return storage.ArchiveConfig{}
+	}
+	return *cfg.Archive
+}
+
+// messageArchive stores messages, sources and attachments of an account as
+// JSON and raw bytes in its storage.Archive.
+type messageArchive struct {
+	*storage.Archive
+	attachments bool
+}
+
+func openArchive(accountData *storage.AccountData) (*messageArchive, error) {
+	archive, err := storage.OpenArchive(storage.Profile(), accountData.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	return &messageArchive{Archive: archive, attachments: archiveSettings().Attachments}, nil
+}
+
+func attachmentRecord(messageID, attachmentID string) string {
+	return messageID + "." + attachmentID
+}
+
+func (a *messageArchive) saveMessage(message *api.MessageDetail) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return a.Put(archivedMessages, message.ID, data)
+}
+
+func (a *messageArchive) message(id string) (*api.MessageDetail, error) {
+	data, err := a.get(archivedMessages, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var message api.MessageDetail
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// messages lists the archived messages, newest first. Damaged records are
+// skipped.
+func (a *messageArchive) messages() ([]api.Message, error) {
+	ids, err := a.List(archivedMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]api.Message, 0, len(ids))
+	for _, id := range ids {
+		if message, err := a.message(id); err == nil {
+			messages = append(messages, message.Message)
+		}
+	}
+	slices.SortFunc(messages, func(x, y api.Message) int {
+		return y.CreatedAt.Compare(x.CreatedAt)
+	})
+	return messages, nil
+}
+
+func (a *messageArchive) get(kind, id string) ([]byte, error) {
+	data, err := a.Get(kind, id)
+	if os.IsNotExist(err) {
+		return nil, errNotArchived
+	}
+	return data, err
+}
+
+// forget drops a message and everything archived with it.
+func (a *messageArchive) forget(messageID string) {
+	_ = a.Remove(archivedMessages, messageID)
+	_ = a.Remove(archivedSources, messageID)
+
+	attachments, _ := a.List(archivedAttachments)
+	for _, id := range attachments {
+		if strings.HasPrefix(id, messageID+".") {
+			_ = a.Remove(archivedAttachments, id)
+		}
+	}
+}
+
+// archivingMailbox reads mail from the server and archives every message
+// and source it gets. Attachments, and messages that were only listed, are
+// fetched by a single background worker, so reading never waits on them.
+// Failing to archive never fails the read.
+type archivingMailbox struct {
+	mailbox
+	archive *messageArchive
+
+	mu     sync.Mutex
+	queued map[archiveJob]bool // every job ever queued, so each runs once
+	queue  []archiveJob
+	idle   chan struct{} // closed once the worker stops; nil when none runs
+}
+
+// archiveJob is a message to fetch and archive or, with attachmentID set,
+// one of its attachments.
+type archiveJob struct {
+	messageID    string
+	attachmentID string
+}
+
+func (m *archivingMailbox) GetMessage(ctx context.Context, id string) (*api.MessageDetail, error) {
+	message, err := m.mailbox.GetMessage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	m.keep(message)
+	return message, nil
+}
+
+// keep archives a message just fetched and queues its attachments.
+func (m *archivingMailbox) keep(message *api.MessageDetail) {
+	_ = m.archive.saveMessage(message)
+
+	m.mu.Lock()
+	m.mark(archiveJob{messageID: message.ID})
+	m.mu.Unlock()
+
+	if m.archive.attachments {
+		jobs := make([]archiveJob, 0, len(message.Attachments))
+		for _, att := range message.Attachments {
+			jobs = append(jobs, archiveJob{messageID: message.ID, attachmentID: att.ID})
+		}
+		m.enqueue(jobs...)
+	}
+}
+
+func (m *archivingMailbox) GetMessageSource(ctx context.Context, id string) ([]byte, error) {
+	source, err := m.mailbox.GetMessageSource(ctx, id)
+	if err == nil {
+		_ = m.archive.Put(archivedSources, id, source)
+	}
+	return source, err
+}
+
+// DeleteMessage deletes the archived copy along with the message: deleting
+// is a choice, unlike the server purging old mail.
+func (m *archivingMailbox) DeleteMessage(ctx context.Context, id string) error {
+	err := m.mailbox.DeleteMessage(ctx, id)
+	if err == nil || errors.Is(err, api.ErrNotFound) {
+		m.archive.forget(id)
+	}
+	return err
+}
+
+// archiveNew queues the messages never queued before, so that the worker
+// fetches those not archived yet. It does not wait for them.
+func (m *archivingMailbox) archiveNew(messages []api.Message) {
+	jobs := make([]archiveJob, 0, len(messages))
+	for _, message := range messages {
+		jobs = append(jobs, archiveJob{messageID: message.ID})
+	}
+	m.enqueue(jobs...)
+}
+
+// enqueue adds the jobs not queued before and starts the worker if none
+// runs.
+func (m *archivingMailbox) enqueue(jobs ...archiveJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range jobs {
+		if m.mark(job) {
+			m.queue = append(m.queue, job)
+		}
+	}
+
+	if len(m.queue) > 0 && m.idle == nil {
+		m.idle = make(chan struct{})
+		go m.work()
+	}
+}
+
+// mark records a job as queued and reports whether it was not before. The
+// caller holds m.mu.
+func (m *archivingMailbox) mark(job archiveJob) bool {
+	if m.queued[job] {
+		return false
+	}
+	if m.queued == nil {
+		m.queued = make(map[archiveJob]bool)
+	}
+	m.queued[job] = true
+	return true
+}
+
+// work runs the queued jobs one at a time until there are none left.
+func (m *archivingMailbox) work() {
+	for {
+		m.mu.Lock()
+		if len(m.queue) == 0 {
+			close(m.idle)
+			m.idle = nil
+			m.mu.Unlock()
+			return
+		}
+		job := m.queue[0]
+		m.queue = m.queue[1:]
+		m.mu.Unlock()
+
+		m.run(job)
+	}
+}
+
+func (m *archivingMailbox) run(job archiveJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	if job.attachmentID == "" {
+		if m.archive.Has(archivedMessages, job.messageID) {
+			return
+		}
+		message, err := m.mailbox.GetMessage(ctx, job.messageID)
+		if err != nil {
+			m.unmark(job)
+			return
+		}
+		m.keep(message)
+		return
+	}
+
+	record := attachmentRecord(job.messageID, job.attachmentID)
+	if m.archive.Has(archivedAttachments, record) {
+		return
+	}
+	err := m.archive.PutStream(archivedAttachments, record, func(w io.Writer) error {
+		_, err := m.mailbox.DownloadAttachmentTo(ctx, job.messageID, job.attachmentID, w, nil)
+		return err
+	})
+	if err != nil {
+		m.unmark(job)
+	}
+}
+
+// unmark lets a failed job be queued again, the next time its message is
+// listed or read.
+func (m *archivingMailbox) unmark(job archiveJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.queued, job)
+}
+
+func (m *archivingMailbox) busy() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.idle != nil
+}
+
+// wait blocks until the worker has nothing left to do or ctx is done.
+func (m *archivingMailbox) wait(ctx context.Context) {
+	for {
+		m.mu.Lock()
+		idle := m.idle
+		m.mu.Unlock()
+		if idle == nil {
+			return
+		}
+
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// archiveMessages queues listed messages for the background worker, so
+// that the TUI keeps a copy of mail that was never opened.
+func archiveMessages(client mailbox, messages []api.Message) {
+	if archiving, ok := client.(*archivingMailbox); ok {
+		archiving.archiveNew(messages)
+	}
+}
+
+// finishArchiving waits for the archiving still running before a command
+// exits, until ctx is done.
+func finishArchiving(ctx context.Context, client mailbox) {
+	archiving, ok := client.(*archivingMailbox)
+	if !ok || !archiving.busy() {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s Archiving attachments, press Ctrl+C to skip\n", cyan("→"))
+	archiving.wait(ctx)
+}
+
+// offlineMailbox serves mail from the archive alone. Everything that needs
+// the server fails with errOffline.
+type offlineMailbox struct {
+	archive *messageArchive
+}
+
+var (
+	_ mailbox = (*api.Client)(nil)
+	_ mailbox = (*archivingMailbox)(nil)
+	_ mailbox = (*offlineMailbox)(nil)
+)
+
+func (m *offlineMailbox) GetMessages(context.Context) ([]api.Message, error) {
+	return m.archive.messages()
+}
+
+func (m *offlineMailbox) GetAllMessages(context.Context) ([]api.Message, error) {
+	return m.archive.messages()
+}
+
+// GetMessagesPage returns the whole archive as the first page.
+func (m *offlineMailbox) GetMessagesPage(_ context.Context, page int) (*api.MessagesPage, error) {
+	if page > 1 {
+		return &api.MessagesPage{Page: page}, nil
+	}
+	messages, err := m.archive.messages()
+	if err != nil {
+		return nil, err
+	}
+	return &api.MessagesPage{Messages: messages, Page: 1, TotalItems: len(messages)}, nil
+}
+
+func (m *offlineMailbox) GetMessage(_ context.Context, id string) (*api.MessageDetail, error) {
+	return m.archive.message(id)
+}
+
+func (m *offlineMailbox) GetMessageSource(_ context.Context, id string) ([]byte, error) {
+	return m.archive.get(archivedSources, id)
+}
+
+func (m *offlineMailbox) DownloadAttachment(_ context.Context, messageID, attachmentID string) ([]byte, error) {
+	return m.archive.get(archivedAttachments, attachmentRecord(messageID, attachmentID))
+}
+
+func (m *offlineMailbox) DownloadAttachmentTo(ctx context.Context, messageID, attachmentID string, w io.Writer, progress api.ProgressFunc) (int64, error) {
+	data, err := m.DownloadAttachment(ctx, messageID, attachmentID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	if progress != nil {
+		progress(int64(n), int64(len(data)))
+	}
+	return int64(n), err
+}
+
+func (m *offlineMailbox) GetDomains(context.Context) ([]api.Domain, error) {
+	return nil, errOffline
+}
+
+func (m *offlineMailbox) CreateAccount(context.Context, string, string) (*api.Account, error) {
+	return nil, errOffline
+}
+
+func (m *offlineMailbox) Login(context.Context, string, string) (string, error) {
+	return "", errOffline
+}
+
+func (m *offlineMailbox) GetAccount(context.Context, string) (*api.Account, error) {
+	return nil, errOffline
+}
+
+func (m *offlineMailbox) GetMe(context.Context) (*api.Account, error) {
+	return nil, errOffline
+}
+
+func (m *offlineMailbox) DeleteAccount(context.Context, string) error {
+	return errOffline
+}
+
+func (m *offlineMailbox) DeleteMessage(context.Context, string) error {
+	return errOffline
+}
+
+func (m *offlineMailbox) MarkMessageAsRead(context.Context, string) error {
+	return errOffline
+}
+
+func (m *offlineMailbox) UpdateMessage(context.Context, string, *bool, *bool) error {
+	return errOffline
+}
+
+func (m *offlineMailbox) Subscribe(context.Context, string) (<-chan api.MessageEvent, error) {
+	return nil, errOffline
+}
+
+func (m *offlineMailbox) SetToken(string) {}
+
+func (m *offlineMailbox) GetToken() string { return "" }
+
+func (m *offlineMailbox) RateLimitState() api.RateLimitState { return api.RateLimitState{} }
+
+func (m *offlineMailbox) TokenExpiresAt() time.Time { return time.Time{} }
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"burnmail/api/apitest"
+	"burnmail/storage"
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestArchiveServesMailOffline(t *testing.T) {
+	t.Setenv("BURNMAIL_HOME", t.TempDir())
+	keyring.MockInit()
+
+	srv := apitest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	address := "archive@" + apitest.DefaultDomain
+	account := srv.AddAccount(address, "secret123")
+	opened, err := srv.Deliver(address, apitest.Message{
+		Subject:     "invoice",
+		Text:        "see attached",
+		Attachments: []apitest.Attachment{{Filename: "invoice.pdf", ContentType: "application/pdf", Data: []byte("%PDF")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed, err := srv.Deliver(address, apitest.Message{Subject: "never opened", Text: "still kept"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := srv.Client()
+	if _, err := client.Login(ctx, address, "secret123"); err != nil {
+		t.Fatal(err)
+	}
+	accountData := &storage.AccountData{Address: address, AccountID: account.ID}
+	archive, err := openArchive(accountData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive.attachments = true
+	online := &archivingMailbox{mailbox: client, archive: archive}
+
+	message, err := online.GetMessage(ctx, opened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := online.GetMessageSource(ctx, opened); err != nil {
+		t.Fatal(err)
+	}
+	all, err := online.GetAllMessages(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := func(prefix string) int {
+		n := 0
+		for _, r := range srv.Requests() {
+			if strings.HasPrefix(r, prefix) {
+				n++
+			}
+		}
+		return n
+	}
+	online.archiveNew(all)
+	online.wait(ctx)
+	if reads := requests("GET /messages/" + opened); reads != 2 {
+		t.Errorf("GET /messages/%s sent %d times, want the read and its attachment only", opened, reads)
+	}
+
+	// Listing again queues nothing: each message is fetched once.
+	before := requests("GET /messages/")
+	online.archiveNew(all)
+	online.wait(ctx)
+	if after := requests("GET /messages/"); after != before {
+		t.Errorf("listing again sent %d more requests, want none", after-before)
+	}
+
+	// The server forgets everything; the archive does not.
+	if err := client.DeleteAccount(ctx, account.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	offline := &offlineMailbox{archive: archive}
+	messages, err := offline.GetAllMessages(ctx)
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("offline GetAllMessages() = %d messages, %v; want 2", len(messages), err)
+	}
+	detail, err := offline.GetMessage(ctx, listed)
+	if err != nil || detail.Text != "still kept" {
+		t.Errorf("offline GetMessage() = %+v, %v; want the listed message", detail, err)
+	}
+	if source, err := offline.GetMessageSource(ctx, opened); err != nil || !bytes.Contains(source, []byte("Subject: invoice")) {
+		t.Errorf("offline GetMessageSource() = %q, %v", source, err)
+	}
+	var file bytes.Buffer
+	if _, err := offline.DownloadAttachmentTo(ctx, opened, message.Attachments[0].ID, &file, nil); err != nil || file.String() != "%PDF" {
+		t.Errorf("offline attachment = %q, %v; want the archived file", file.String(), err)
+	}
+	if _, err := offline.GetMessageSource(ctx, listed); !errors.Is(err, errNotArchived) {
+		t.Errorf("source never fetched: error = %v, want errNotArchived", err)
+	}
+	if err := offline.DeleteMessage(ctx, opened); !errors.Is(err, errOffline) {
+		t.Errorf("offline DeleteMessage() error = %v, want errOffline", err)
+	}
+}
+
+func TestOfflineReadsArchiveOfDeletedAccount(t *testing.T) {
+	t.Setenv("BURNMAIL_HOME", t.TempDir())
+	keyring.MockInit()
+	t.Cleanup(func() {
+		offlineFlag = false
+		archiveFlag = ""
+	})
+
+	srv := apitest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	address := "deleted@" + apitest.DefaultDomain
+	account := srv.AddAccount(address, "secret123")
+	id, err := srv.Deliver(address, apitest.Message{Subject: "receipt", Text: "keep me"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accountData := &storage.AccountData{Address: address, Password: "secret123", AccountID: account.ID, APIURL: srv.URL}
+	if err := storage.Save(accountData); err != nil {
+		t.Fatal(err)
+	}
+	online := openMailboxOrExit(accountData)
+	if _, err := online.GetMessage(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	// What 'burnmail d' does locally.
+	if err := storage.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := storage.Load(); saved != nil {
+		t.Fatal("the account file should be gone")
+	}
+
+	offlineFlag = true
+	archived := mailAccountOrExit()
+	if archived == nil || archived.Address != address {
+		t.Fatalf("mailAccountOrExit() = %+v, want the deleted account from its archive", archived)
+	}
+	messages, err := openMailboxOrExit(archived).GetAllMessages(ctx)
+	if err != nil || len(messages) != 1 || messages[0].ID != id {
+		t.Errorf("offline GetAllMessages() = %+v, %v; want the archived message", messages, err)
+	}
+
+	archiveFlag = "someone-else@" + apitest.DefaultDomain
+	if mailAccountOrExit() != nil {
+		t.Error("--archive naming no archive should fail")
+	}
+}
@@ -1,8 +1,12 @@
 package cmd
 
 import (
+	"burnmail/storage"
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/fatih/color"
@@ -10,11 +14,11 @@ import (
 )
 
 const (
-	htmlFileCleanupDelay = 30 * time.Second
-	retryMaxAttempts     = 3
-	retryBaseDelay       = 1 * time.Second
-	retryMaxDelay        = 10 * time.Second
-	requestTimeout       = 30 * time.Second
+	htmlFileCleanupDelay  = 30 * time.Second
+	retryMaxAttempts      = 3
+	requestTimeout        = 30 * time.Second
+	createAccountAttempts = 3
+	quotaWarningThreshold = 0.9
 )
 
 var (
@@ -27,11 +31,35 @@ var (
 var (
 	Version string
 
+	providerFlag      string
+	apiURLFlag        string
+	proxyFlag         string
+	caCertFlag        string
+	debugFlag         string
+	profileFlag       string
+	insecurePlaintext bool
+	secretEnvFlag     string
+	secretFileFlag    string
+	secretCommandFlag string
+	rawOutput         string
+	markRead          bool
+	markUnread        bool
+	markFlag          bool
+	markUnflag        bool
+	domainFlag        string
+	randomDomain      bool
+	ttlFlag           time.Duration
+	offlineFlag       bool
+	archiveFlag       string
+	purgeAll          bool
+
 	rootCmd = &cobra.Command{
 		Use:     "burnmail",
 		Short:   "🔥 Burn through temporary emails straight from your terminal",
 		Long:    `Burnmail is a CLI tool to quickly generate and manage disposable email addresses using mail.tm API.`,
 		Version: Version,
+
+		PersistentPreRunE: prepare,
 	}
 )
 
@@ -42,6 +70,12 @@ var generateCmd = &cobra.Command{
 	Run:     generateEmail,
 }
 
+var domainsCmd = &cobra.Command{
+	Use:   "domains",
+	Short: "List the domains available for new addresses",
+	Run:   listDomains,
+}
+
 var messagesCmd = &cobra.Command{
 	Use:     "m",
 	Aliases: []string{"messages", "inbox"},
@@ -56,16 +90,104 @@ var messagesListCmd = &cobra.Command{
 	Run:     viewMessages,
 }
 
+var messagesRawCmd = &cobra.Command{
+	Use:   "raw <id>",
+	Short: "Print the raw RFC 822 source of a message",
+	Args:  cobra.ExactArgs(1),
+	Run:   viewMessageSource,
+}
+
+var messagesMarkCmd = &cobra.Command{
+	Use:   "mark <id>...",
+	Short: "Mark messages as read or unread, and flag or unflag them",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   markMessages,
+}
+
 var deleteCmd = &cobra.Command{
 	Use:     "d",
 	Aliases: []string{"delete"},
 	Short:   "Delete the current account",
-	Run:     deleteAccount,
+	Long: `Delete the current account on the server and locally. Its archived mail is
+kept and can still be read with 'burnmail m --offline'; remove it with
+'burnmail archive purge'.`,
+	Run: deleteAccount,
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Burn every account whose TTL has run out",
+	Long: `Delete every account created with 'burnmail g --ttl' whose time is up: the
+address on the server, then its archived mail, the local account, message
+cache and the attachments saved from it.
+Other commands do this on their own when they start; gc also checks accounts
+that were written without the expiry index.`,
+	Args: cobra.NoArgs,
+	Run:  collectGarbage,
+}
+
+var accountsCmd = &cobra.Command{
+	Use:   "accounts",
+	Short: "Manage the accounts kept in profiles",
+}
+
+var accountsListCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "List profiles and their addresses",
+	Args:    cobra.NoArgs,
+	Run:     listAccounts,
+}
+
+var useCmd = &cobra.Command{
+	Use:   "use <profile>",
+	Short: "Make a profile the one commands use by default",
+	Args:  cobra.ExactArgs(1),
+	Run:   useProfile,
+}
+
+var keyringCmd = &cobra.Command{
+	Use:   "keyring",
+	Short: "Manage where the account encryption key is kept",
+}
+
+var keyringMigrateCmd = &cobra.Command{
+	Use:   "migrate <keyring|passphrase|env|file|command>",
+	Short: "Re-encrypt every profile with a key from another secret store",
+	Long: `Re-encrypt every profile with a key from another secret store and make it
+the default. The old key is deleted from the keyring once it is no longer used.
+
+  burnmail keyring migrate passphrase
+  burnmail keyring migrate env --env BURNMAIL_SECRET
+  burnmail keyring migrate file --file ~/.config/burnmail/key.txt
+  burnmail keyring migrate command --command "pass show burnmail/{profile}"`,
+	ValidArgs: []string{"keyring", "passphrase", "env", "file", "command"},
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	Run:       migrateSecrets,
+}
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Manage the archived mail kept after accounts are gone",
+}
+
+var archiveListCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "List archives by profile and address",
+	Args:    cobra.NoArgs,
+	Run:     listArchives,
+}
+
+var archivePurgeCmd = &cobra.Command{
+	Use:   "purge [<address|account id>...]",
+	Short: "Delete archived mail of the current profile for good",
+	Run:   purgeArchives,
 }
 
 var meCmd = &cobra.Command{
 	Use:   "me",
-	Short: "Show account details",
+	Short: "Show account details, quota usage and token status",
 	Run:   showAccount,
 }
 
@@ -126,18 +248,98 @@ var exportCmd = &cobra.Command{
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&providerFlag, "provider", "", "mail provider to use (mailtm, mailgw)")
+	rootCmd.PersistentFlags().StringVar(&apiURLFlag, "api-url", "", "base URL of a Hydra-compatible mail API (overrides --provider)")
+	rootCmd.PersistentFlags().StringVar(&proxyFlag, "proxy", "", "proxy URL (http, https, socks5 or socks5h); defaults to HTTPS_PROXY")
+	rootCmd.PersistentFlags().StringVar(&caCertFlag, "ca-cert", "", "PEM file with extra CA certificates to trust")
+	rootCmd.PersistentFlags().StringVar(&debugFlag, "debug", "", "trace HTTP requests to stderr, or to a file with --debug=FILE (or set BURNMAIL_DEBUG)")
+	rootCmd.PersistentFlags().Lookup("debug").NoOptDefVal = "stderr"
+	rootCmd.PersistentFlags().BoolVar(&insecurePlaintext, "insecure-plaintext", false, "store accounts unencrypted when no keyring or passphrase is available")
+	rootCmd.PersistentFlags().StringVar(&profileFlag, "profile", "", "account profile to use (or set BURNMAIL_PROFILE; see 'burnmail accounts ls')")
+
+	generateCmd.Flags().StringVar(&domainFlag, "domain", "", "create the address on this domain (see 'burnmail domains')")
+	generateCmd.Flags().BoolVar(&randomDomain, "random-domain", false, "pick a random active domain")
+	generateCmd.MarkFlagsMutuallyExclusive("domain", "random-domain")
+	generateCmd.Flags().DurationVar(&ttlFlag, "ttl", 0, "burn the inbox after this long, e.g. 30m or 2h (see 'burnmail gc')")
 	rootCmd.AddCommand(generateCmd)
+	rootCmd.AddCommand(domainsCmd)
 	rootCmd.AddCommand(messagesCmd)
+	messagesCmd.PersistentFlags().BoolVar(&offlineFlag, "offline", false, "read from the local archive instead of the server")
+	messagesCmd.PersistentFlags().StringVar(&archiveFlag, "archive", "", "read the archive of this address or account ID; implies --offline (see 'burnmail archive ls')")
 	messagesCmd.AddCommand(messagesListCmd)
+	messagesRawCmd.Flags().StringVarP(&rawOutput, "output", "o", "", "write the source to a .eml file instead of stdout")
+	messagesCmd.AddCommand(messagesRawCmd)
+	messagesMarkCmd.Flags().BoolVar(&markRead, "read", false, "mark as read")
+	messagesMarkCmd.Flags().BoolVar(&markUnread, "unread", false, "mark as unread")
+	messagesMarkCmd.Flags().BoolVar(&markFlag, "flag", false, "flag the messages")
+	messagesMarkCmd.Flags().BoolVar(&markUnflag, "unflag", false, "remove the flag")
+	messagesMarkCmd.MarkFlagsMutuallyExclusive("read", "unread")
+	messagesMarkCmd.MarkFlagsMutuallyExclusive("flag", "unflag")
+	messagesMarkCmd.MarkFlagsOneRequired("read", "unread", "flag", "unflag")
+	messagesCmd.AddCommand(messagesMarkCmd)
 	rootCmd.AddCommand(deleteCmd)
 	rootCmd.AddCommand(meCmd)
+	rootCmd.AddCommand(gcCmd)
+	accountsCmd.AddCommand(accountsListCmd)
+	rootCmd.AddCommand(accountsCmd)
+	rootCmd.AddCommand(useCmd)
+	keyringMigrateCmd.Flags().StringVar(&secretEnvFlag, "env", "", "environment variable holding the secret (default BURNMAIL_PASSPHRASE)")
+	keyringMigrateCmd.Flags().StringVar(&secretFileFlag, "file", "", "file holding the secret; created if missing")
+	keyringMigrateCmd.Flags().StringVar(&secretCommandFlag, "command", "", "command printing the secret, e.g. \"pass show burnmail\"")
+	keyringCmd.AddCommand(keyringMigrateCmd)
+	rootCmd.AddCommand(keyringCmd)
+	archiveCmd.AddCommand(archiveListCmd)
+	archivePurgeCmd.Flags().BoolVar(&purgeAll, "all", false, "purge every archive of the profile")
+	archiveCmd.AddCommand(archivePurgeCmd)
+	rootCmd.AddCommand(archiveCmd)
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(completionCmd)
+	exportCmd.Flags().BoolVar(&offlineFlag, "offline", false, "export from the local archive instead of the server")
+	exportCmd.Flags().StringVar(&archiveFlag, "archive", "", "export the archive of this address or account ID; implies --offline")
 	rootCmd.AddCommand(exportCmd)
 }
 
+// prepare runs before every command. It moves files left in the home
+// directory by older versions, sets up how accounts are protected, burns
+// expired accounts, then selects the profile.
+func prepare(cmd *cobra.Command, args []string) error {
+	moved, err := storage.MigrateLegacyFiles()
+	for _, m := range moved {
+		fmt.Fprintf(os.Stderr, "%s Moved %s to %s\n", cyan("→"), m.From, m.To)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s Could not move old files: %v\n", yellow("⚠"), err)
+	}
+
+	if err := setupSecretStore(); err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+	storage.SetInsecurePlaintext(insecurePlaintext)
+	// Traces on stderr would be drawn over by the TUI; set before any
+	// client is made.
+	debugToFile = cmd == messagesCmd
+	if archiveFlag != "" {
+		offlineFlag = true
+	}
+	// Before the prompt is set up, so that an expired profile never asks
+	// for its passphrase just to be burned.
+	if runsGC(cmd) {
+		collectExpired(cmd.Context())
+	}
+	if isTerminal(os.Stdin) {
+		storage.SetPassphrasePrompt(promptPassphrase)
+	}
+	return selectProfile(cmd, args)
+}
+
+// Execute runs the root command. Interrupting the process cancels the
+// command context, which aborts any in-flight API request.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestGenerateRandomString(t *testing.T) {
@@ -38,3 +40,123 @@ func TestGenerateRandomStringUniqueness(t *testing.T) {
 		t.Error("generateRandomString() generated duplicate strings")
 	}
 }
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KB"},
+		{40000000, "38.1 MB"},
+	}
+
+	for _, tt := range tests {
+		if got := formatBytes(tt.in); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatRemaining(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+	}{
+		{-time.Minute, "0s"},
+		{45 * time.Second, "45s"},
+		{12*time.Minute + 30*time.Second, "12m"},
+		{5*time.Hour + 7*time.Minute, "5h 07m"},
+		{50 * time.Hour, "2d"},
+	}
+
+	for _, tt := range tests {
+		if got := formatRemaining(tt.in); got != tt.want {
+			t.Errorf("formatRemaining(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDescribeChange(t *testing.T) {
+	tests := []struct {
+		name                       string
+		read, unread, flag, unflag bool
+		want                       string
+	}{
+		{"read", true, false, false, false, "marked as read"},
+		{"unread and flag", false, true, true, false, "marked as unread, flagged"},
+		{"unflag only", false, false, false, true, "unflagged"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := describeChange(boolChange(tt.read, tt.unread), boolChange(tt.flag, tt.unflag))
+			if got != tt.want {
+				t.Errorf("describeChange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebugTarget(t *testing.T) {
+	tests := []struct {
+		flag, env, want string
+	}{
+		{"", "", ""},
+		{"", "0", ""},
+		{"", "1", "stderr"},
+		{"", "TRUE", "stderr"},
+		{"", "/tmp/trace.log", "/tmp/trace.log"},
+		{"stderr", "/tmp/trace.log", "stderr"},
+		{"/tmp/flag.log", "1", "/tmp/flag.log"},
+	}
+
+	for _, tt := range tests {
+		debugFlag = tt.flag
+		t.Setenv("BURNMAIL_DEBUG", tt.env)
+		if got := debugTarget(); got != tt.want {
+			t.Errorf("debugTarget() with --debug=%q, BURNMAIL_DEBUG=%q = %q, want %q", tt.flag, tt.env, got, tt.want)
+		}
+	}
+	debugFlag = ""
+}
+
+func TestDebugLogTargetUnderTUI(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("BURNMAIL_HOME", home)
+	t.Setenv("BURNMAIL_DEBUG", "1")
+	t.Cleanup(func() { debugToFile = false })
+
+	if got := debugLogTarget(); got != "stderr" {
+		t.Errorf("debugLogTarget() = %q, want stderr outside the TUI", got)
+	}
+
+	debugToFile = true
+	if got, want := debugLogTarget(), filepath.Join(home, "debug.log"); got != want {
+		t.Errorf("debugLogTarget() under the TUI = %q, want %q", got, want)
+	}
+	t.Setenv("BURNMAIL_DEBUG", "/tmp/trace.log")
+	if got := debugLogTarget(); got != "/tmp/trace.log" {
+		t.Errorf("debugLogTarget() = %q, want the file asked for", got)
+	}
+}
+
+func TestValidatePassphrase(t *testing.T) {
+	tests := []struct {
+		input      string
+		allowEmpty bool
+		valid      bool
+	}{
+		{"", false, false},
+		{"", true, true},
+		{"short", true, false},
+		{"long enough", false, true},
+	}
+
+	for _, tt := range tests {
+		if err := validatePassphrase(tt.allowEmpty)(tt.input); (err == nil) != tt.valid {
+			t.Errorf("validatePassphrase(%v)(%q) error = %v, want valid %v", tt.allowEmpty, tt.input, err, tt.valid)
+		}
+	}
+}
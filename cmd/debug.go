@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"burnmail/storage"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	debugOnce   sync.Once
+	debugLogger *slog.Logger
+	// debugToFile keeps traces off stderr while the TUI draws there.
+	debugToFile bool
+)
+
+// debugTarget returns where HTTP traces go: "" when tracing is off,
+// "stderr", or a file path. --debug wins over BURNMAIL_DEBUG.
+func debugTarget() string {
+	value := debugFlag
+	if value == "" {
+		value = os.Getenv("BURNMAIL_DEBUG")
+	}
+
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "0", "false", "off":
+		return ""
+	case "1", "true", "on", "stderr":
+		return "stderr"
+	}
+	return value
+}
+
+// debugLogTarget is debugTarget, except that stderr becomes the debug log
+// in the state directory while the TUI runs.
+func debugLogTarget() string {
+	target := debugTarget()
+	if target != "stderr" || !debugToFile {
+		return target
+	}
+
+	path, err := storage.DebugLogPath()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0700)
+	}
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// getDebugLogger returns the logger for HTTP traces, or nil when tracing is
+// off. A log file that cannot be opened falls back to stderr, except under
+// the TUI, where tracing is then off.
+func getDebugLogger() *slog.Logger {
+	debugOnce.Do(func() {
+		target := debugLogTarget()
+		if target == "" {
+			return
+		}
+
+		var w io.Writer = os.Stderr
+		if target != "stderr" {
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+			switch {
+			case err == nil:
+				w = f
+			case debugToFile:
+				fmt.Fprintf(os.Stderr, "%s Cannot open debug log %s, tracing is off: %v\n", yellow("⚠"), target, err)
+				return
+			default:
+				fmt.Fprintf(os.Stderr, "%s Cannot open debug log %s, logging to stderr: %v\n", yellow("⚠"), target, err)
+			}
+			if debugToFile {
+				fmt.Fprintf(os.Stderr, "%s Tracing requests to %s\n", cyan("→"), target)
+			}
+		}
+		debugLogger = slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	})
+	return debugLogger
+}
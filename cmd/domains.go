@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"burnmail/api"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func listDomains(cmd *cobra.Command, _ []string) {
+	client := newClientOrExit(nil)
+	if client == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), requestTimeout)
+	defer cancel()
+
+	result, err := retryWithBackoff(ctx, func() (interface{}, error) {
+		return client.GetDomains(ctx)
+	})
+	if err != nil {
+		printFailure("get domains", err)
+		return
+	}
+
+	domains := result.([]api.Domain)
+	if len(domains) == 0 {
+		fmt.Printf("%s No domains available\n", red("✗"))
+		return
+	}
+
+	fmt.Println()
+	for _, d := range domains {
+		var notes []string
+		if !d.IsActive {
+			notes = append(notes, "inactive")
+		}
+		if d.IsPrivate {
+			notes = append(notes, "private")
+		}
+
+		if len(notes) == 0 {
+			fmt.Printf("  %s %s\n", green("●"), d.Domain)
+		} else {
+			fmt.Printf("  %s %s %s\n", yellow("○"), d.Domain, yellow("("+strings.Join(notes, ", ")+")"))
+		}
+	}
+	fmt.Printf("\nUse '%s' to pick one.\n\n", yellow("burnmail g --domain <domain>"))
+}
+
+// pickDomains orders the domains to try for a new address. An explicit
+// choice is the only candidate; otherwise every public active domain is
+// returned, first as listed or shuffled when random is set.
+func pickDomains(domains []api.Domain, preferred string, random bool) ([]string, error) {
+	if preferred != "" {
+		for _, d := range domains {
+			if strings.EqualFold(d.Domain, preferred) {
+				if !d.IsActive {
+					return nil, fmt.Errorf("domain %s is not active", d.Domain)
+				}
+				return []string{d.Domain}, nil
+			}
+		}
+		return nil, fmt.Errorf("domain %s is not offered; see 'burnmail domains'", preferred)
+	}
+
+	var candidates []string
+	for _, d := range domains {
+		if d.IsActive && !d.IsPrivate {
+			candidates = append(candidates, d.Domain)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no active domains found")
+	}
+
+	if random {
+		rand.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+	}
+	return candidates, nil
+}
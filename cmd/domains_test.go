@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"burnmail/api"
+	"burnmail/api/apitest"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPickDomains(t *testing.T) {
+	domains := []api.Domain{
+		{Domain: "first.test", IsActive: true},
+		{Domain: "old.test", IsActive: false},
+		{Domain: "mine.test", IsActive: true, IsPrivate: true},
+		{Domain: "second.test", IsActive: true},
+	}
+
+	tests := []struct {
+		name      string
+		preferred string
+		want      []string
+		wantErr   bool
+	}{
+		{"public active domains in order", "", []string{"first.test", "second.test"}, false},
+		{"explicit domain only", "SECOND.test", []string{"second.test"}, false},
+		{"explicit private domain", "mine.test", []string{"mine.test"}, false},
+		{"inactive domain", "old.test", nil, true},
+		{"unknown domain", "nope.test", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pickDomains(domains, tt.preferred, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pickDomains() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("pickDomains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	random, _ := pickDomains(domains, "", true)
+	slices.Sort(random)
+	if !slices.Equal(random, []string{"first.test", "second.test"}) {
+		t.Errorf("random pick = %v, want both public domains", random)
+	}
+}
+
+func TestCreateAccountFallsBackToNextDomain(t *testing.T) {
+	srv := apitest.NewServer()
+	defer srv.Close()
+	srv.AddDomain("blocked.test", false)
+
+	address, account, err := createAccount(context.Background(), srv.Client(), []string{"blocked.test", apitest.DefaultDomain}, "secret123")
+	if err != nil {
+		t.Fatalf("createAccount failed: %v", err)
+	}
+	if !strings.HasSuffix(address, "@"+apitest.DefaultDomain) || account.Address != address {
+		t.Errorf("created %s (%s), want an address on %s", address, account.Address, apitest.DefaultDomain)
+	}
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"burnmail/api"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+)
+
+const (
+	downloadProgressInterval = 100 * time.Millisecond
+	// maxDownloadNameAttempts bounds the names tried for one attachment.
+	maxDownloadNameAttempts = 1000
+)
+
+// download tracks one attachment being saved from the TUI
+type download struct {
+	filename string
+	path     string
+	written  int64
+	total    int64
+	done     bool
+	err      error
+}
+
+type downloadProgressMsg struct {
+	key     string
+	written int64
+	total   int64
+	updates <-chan tea.Msg
+}
+
+type downloadDoneMsg struct {
+	key  string
+	path string
+	err  error
+}
+
+func downloadKey(messageID, attachmentID string) string {
+	return messageID + "/" + attachmentID
+}
+
+// startDownload streams an attachment to the downloads directory in the
+// background. Progress and the final result come back as messages.
+func startDownload(ctx context.Context, client mailbox, messageID string, att api.Attachment) tea.Cmd {
+	key := downloadKey(messageID, att.ID)
+	updates := make(chan tea.Msg, 1)
+
+	go func() {
+		var lastSent time.Time
+		path, err := saveAttachment(ctx, client, messageID, att, func(written, total int64) {
+			if time.Since(lastSent) < downloadProgressInterval {
+				return
+			}
+			lastSent = time.Now()
+
+			select {
+			case updates <- downloadProgressMsg{key: key, written: written, total: total, updates: updates}:
+			default:
+				// The previous update has not been drawn yet; skip this one.
+			}
+		})
+		updates <- downloadDoneMsg{key: key, path: path, err: err}
+	}()
+
+	return waitForDownload(updates)
+}
+
+func waitForDownload(updates <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-updates
+	}
+}
+
+// saveAttachment writes an attachment to a new file, removing it again if
+// the download fails half-way.
+func saveAttachment(ctx context.Context, client mailbox, messageID string, att api.Attachment, progress api.ProgressFunc) (string, error) {
+	file, filePath, err := createDownloadFile(getDownloadsDir(), att.Filename)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = client.DownloadAttachmentTo(ctx, messageID, att.ID, file, progress)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(filePath)
+		return "", err
+	}
+
+	return filePath, nil
+}
+
+// createDownloadFile creates a new file in dir for filename. A name taken
+// between checking and creating it, as when two attachments of the same
+// name are saved at once, moves it on to the next one.
+func createDownloadFile(dir, filename string) (*os.File, string, error) {
+	var err error
+	for counter := 0; counter < maxDownloadNameAttempts; counter++ {
+		filePath := downloadCandidate(dir, filename, counter)
+		var file *os.File
+		file, err = os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return file, filePath, nil
+		}
+		if !os.IsExist(err) {
+			return nil, "", err
+		}
+	}
+	return nil, "", err
+}
+
+// downloadCandidate returns the counter-th path tried for filename in dir:
+// the name itself, then name_1.ext, name_2.ext and so on. The name comes
+// from the sender, so anything but its base is dropped.
+func downloadCandidate(dir, filename string, counter int) string {
+	name := filepath.Base(filepath.Clean("/" + filename))
+	if name == "/" || name == "." || name == string(filepath.Separator) {
+		name = "attachment"
+	}
+	if counter == 0 {
+		return filepath.Join(dir, name)
+	}
+
+	ext := filepath.Ext(name)
+	return filepath.Join(dir, fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), counter, ext))
+}
+
+// queueDownload registers and starts a download unless the same attachment
+// is already in progress.
+func (m *model) queueDownload(att api.Attachment) tea.Cmd {
+	key := downloadKey(m.selectedMsg.ID, att.ID)
+	if d, ok := m.downloads[key]; ok && !d.done {
+		return nil
+	}
+
+	m.downloads[key] = &download{filename: att.Filename, total: int64(att.Size)}
+	return startDownload(m.ctx, m.client, m.selectedMsg.ID, att)
+}
+
+// handleDownloadDone records the result of a download. Files saved from an
+// account with a TTL are added to it, to be deleted along with it.
+func (m *model) handleDownloadDone(msg downloadDoneMsg) tea.Cmd {
+	d, ok := m.downloads[msg.key]
+	if !ok {
+		return nil
+	}
+
+	d.done = true
+	d.path = msg.path
+	d.err = msg.err
+	if d.err != nil {
+		m.statusMessage = fmt.Sprintf("Failed to download %s: %v", d.filename, d.err)
+		return nil
+	}
+	d.written = d.total
+	m.statusMessage = fmt.Sprintf("Saved %s to %s", d.filename, d.path)
+
+	if m.accountData.ExpiresAt.IsZero() {
+		return nil
+	}
+	return rememberDownload(m.accountData.AccountID, d.path)
+}
+
+// renderDownloads lists the downloads of the open message with a progress
+// bar for the ones still running.
+func (m *model) renderDownloads() string {
+	if m.selectedMsg == nil {
+		return ""
+	}
+
+	var s strings.Builder
+	for _, att := range m.selectedMsg.Attachments {
+		d, ok := m.downloads[downloadKey(m.selectedMsg.ID, att.ID)]
+		if !ok {
+			continue
+		}
+
+		name := truncate(d.filename, 30)
+		switch {
+		case d.err != nil:
+			s.WriteString("  " + errorStyle.Render("✗ "+name+": "+d.err.Error()) + "\n")
+		case d.done:
+			s.WriteString("  " + successStyle.Render("✓ "+name) + descStyle.Render(" → "+d.path) + "\n")
+		case d.total > 0:
+			percent := min(float64(d.written)/float64(d.total), 1)
+			s.WriteString("  " + keyStyle.Render(name) + " " + m.progress.ViewAs(percent) + "\n")
+		default:
+			s.WriteString("  " + keyStyle.Render(name) + descStyle.Render(fmt.Sprintf(" %.1f KB", float64(d.written)/1024.0)) + "\n")
+		}
+	}
+	return s.String()
+}
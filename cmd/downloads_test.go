@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestCreateDownloadFile(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{"plain name", "report.pdf", "report.pdf"},
+		{"path traversal", "../../.bashrc", ".bashrc"},
+		{"nested path", "a/b/c.txt", "c.txt"},
+		{"empty name", "", "attachment"},
+		{"taken name", "report.pdf", "report_1.pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, got, err := createDownloadFile(dir, tt.filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = file.Close()
+			if want := filepath.Join(dir, tt.want); got != want {
+				t.Errorf("createDownloadFile(%q) = %q, want %q", tt.filename, got, want)
+			}
+		})
+	}
+}
+
+func TestCreateDownloadFileSameNameAtOnce(t *testing.T) {
+	dir := t.TempDir()
+
+	const n = 8
+	var wg sync.WaitGroup
+	paths := make([]string, n)
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var file *os.File
+			file, paths[i], errs[i] = createDownloadFile(dir, "invoice.pdf")
+			if file != nil {
+				_ = file.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i := range n {
+		if errs[i] != nil {
+			t.Fatalf("createDownloadFile() error = %v, want every attachment saved", errs[i])
+		}
+		if seen[paths[i]] {
+			t.Errorf("%s was handed out twice", paths[i])
+		}
+		seen[paths[i]] = true
+	}
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"burnmail/api"
 	"burnmail/storage"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -23,16 +24,20 @@ type MessageExport struct {
 	IsIncluded bool `json:"isIncluded"`
 }
 
-func exportData(_ *cobra.Command, _ []string) {
-	accountData := loadAccountOrExit()
+func exportData(cmd *cobra.Command, _ []string) {
+	accountData := mailAccountOrExit()
 	if accountData == nil {
 		return
 	}
 
-	client := api.GetClient()
-	client.SetToken(accountData.Token)
+	client := openMailboxOrExit(accountData)
+	if client == nil {
+		return
+	}
+
+	ctx := cmd.Context()
 
-	messages, success := fetchMessages(client)
+	messages, success := fetchMessages(ctx, client)
 	if !success {
 		return
 	}
@@ -44,22 +49,11 @@ func exportData(_ *cobra.Command, _ []string) {
 
 	fmt.Printf("%s Found %d messages. Fetching details...\n", cyan("📖"), len(messages))
 
-	exportedMessages := make([]MessageExport, 0, len(messages))
-	for i, msg := range messages {
-		fmt.Printf("\r%s Fetching message %d/%d...", cyan("⏳"), i+1, len(messages))
-
-		fullMessage, err := client.GetMessage(msg.ID)
-		if err != nil {
-			fmt.Printf("\n%s Failed to fetch message %s: %v\n", yellow("⚠"), msg.ID, err)
-			continue
-		}
-
-		exportedMessages = append(exportedMessages, MessageExport{
-			MessageDetail: fullMessage,
-			IsIncluded:    true,
-		})
+	exportedMessages, ok := fetchMessageDetails(ctx, client, messages)
+	if !ok {
+		fmt.Printf("\n%s Export cancelled\n", yellow("⚠"))
+		return
 	}
-	fmt.Println() // New line after progress
 
 	exportDataStruct := ExportData{
 		Account:    accountData,
@@ -88,4 +82,35 @@ func exportData(_ *cobra.Command, _ []string) {
 	fmt.Printf("%s File: %s\n", cyan("💾"), filename)
 	fmt.Printf("%s Messages exported: %d\n", cyan("📧"), len(exportedMessages))
 	fmt.Printf("%s Full path: %s\n\n", cyan("📍"), fullPath)
+	finishArchiving(ctx, client)
+}
+
+// fetchMessageDetails loads the full body of every message, skipping the ones
+// that fail. It reports false if ctx ended first.
+func fetchMessageDetails(ctx context.Context, client api.Provider, messages []api.Message) ([]MessageExport, bool) {
+	exportedMessages := make([]MessageExport, 0, len(messages))
+	for i, msg := range messages {
+		if ctx.Err() != nil {
+			return nil, false
+		}
+
+		fmt.Printf("\r%s Fetching message %d/%d...", cyan("⏳"), i+1, len(messages))
+
+		fullMessage, err := client.GetMessage(ctx, msg.ID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, false
+			}
+			fmt.Printf("\n%s Failed to fetch message %s: %v\n", yellow("⚠"), msg.ID, err)
+			continue
+		}
+
+		exportedMessages = append(exportedMessages, MessageExport{
+			MessageDetail: fullMessage,
+			IsIncluded:    true,
+		})
+	}
+	fmt.Println() // New line after progress
+
+	return exportedMessages, true
 }
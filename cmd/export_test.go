@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"burnmail/api"
+	"burnmail/api/apitest"
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestFetchMessageDetailsSkipsFailures(t *testing.T) {
+	srv := apitest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	address := "export@" + apitest.DefaultDomain
+	srv.AddAccount(address, "secret123")
+	for _, subject := range []string{"first", "second", "third"} {
+		if _, err := srv.Deliver(address, apitest.Message{Subject: subject, Text: subject + " body"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := srv.Client()
+	if _, err := client.Login(ctx, address, "secret123"); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, ok := fetchMessages(ctx, client)
+	if !ok || len(messages) != 3 {
+		t.Fatalf("fetchMessages() = %d messages, %v", len(messages), ok)
+	}
+
+	srv.Inject(apitest.Fault{Method: "GET", Path: "/messages/" + messages[1].ID, Status: http.StatusInternalServerError})
+
+	exported, ok := fetchMessageDetails(ctx, client, messages)
+	if !ok {
+		t.Fatal("fetchMessageDetails reported a cancellation")
+	}
+	if len(exported) != 2 {
+		t.Fatalf("exported %d messages, want 2", len(exported))
+	}
+	for _, m := range exported {
+		if m.Text != m.Subject+" body" {
+			t.Errorf("message %s has text %q", m.Subject, m.Text)
+		}
+	}
+}
+
+func TestFetchMessageDetailsCancelled(t *testing.T) {
+	srv := apitest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, ok := fetchMessageDetails(ctx, srv.Client(), make([]api.Message, 1)); ok {
+		t.Error("fetchMessageDetails should stop once ctx is cancelled")
+	}
+}
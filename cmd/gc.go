@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"burnmail/api"
+	"burnmail/storage"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/spf13/cobra"
+)
+
+// gcTimeout bounds the collection run before other commands, so an
+// unreachable server delays them only a little.
+const gcTimeout = 10 * time.Second
+
+// collectGarbage burns every account whose TTL has run out
+func collectGarbage(cmd *cobra.Command, _ []string) {
+	profiles, err := storage.ListProfiles()
+	if err != nil {
+		fmt.Printf("%s Failed to list accounts: %v\n", red("✗"), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), requestTimeout)
+	defer cancel()
+
+	burned := 0
+	for _, name := range profiles {
+		account, err := storage.LoadProfile(name)
+		if err != nil {
+			fmt.Printf("%s Skipped profile %s: %v\n", yellow("⚠"), name, err)
+			continue
+		}
+		if account == nil || !account.Expired(time.Now()) {
+			continue
+		}
+
+		if err := burnAccount(ctx, name, account); err != nil {
+			printFailure(fmt.Sprintf("burn %s (profile %s)", account.Address, name), err)
+			continue
+		}
+		fmt.Printf("%s Burned %s (profile %s)\n", green("✓"), account.Address, name)
+		burned++
+	}
+
+	if burned == 0 {
+		fmt.Printf("%s No expired accounts\n", green("✓"))
+	}
+}
+
+// collectExpired burns the accounts that the expiry index lists as run out.
+// It runs before other commands, so it only decrypts those profiles, never
+// prompts for a passphrase, and says nothing unless it deletes something or
+// cannot open a profile.
+func collectExpired(ctx context.Context) {
+	profiles, err := storage.ExpiredProfiles(time.Now())
+	if err != nil || len(profiles) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gcTimeout)
+	defer cancel()
+
+	for _, name := range profiles {
+		account, err := storage.LoadProfile(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s Could not burn the expired inbox of profile %s: %v\n", yellow("⚠"), name, err)
+			fmt.Fprintf(os.Stderr, "  Run '%s' to burn it.\n", yellow("burnmail gc"))
+			continue
+		}
+		if account == nil || !account.Expired(time.Now()) {
+			continue
+		}
+		if burnAccount(ctx, name, account) == nil {
+			fmt.Fprintf(os.Stderr, "%s Burned expired inbox %s (profile %s)\n", cyan("→"), account.Address, name)
+		}
+	}
+}
+
+// runsGC reports whether collectExpired should run before cmd. Commands
+// that never touch an account skip it, and so does --offline, which must
+// not reach the server.
+func runsGC(cmd *cobra.Command) bool {
+	if offlineFlag {
+		return false
+	}
+	switch cmd {
+	case gcCmd, versionCmd, completionCmd:
+		return false
+	}
+	return cmd.Name() != "help" && cmd.Name() != cobra.ShellCompRequestCmd
+}
+
+// burnAccount deletes an account on the server, then everything kept of it
+// locally: its archive, the account file, the message cache and the
+// attachments saved from it. Unlike 'burnmail d', nothing is left to read
+// with --offline. When the server cannot be reached the local data is kept,
+// so that the next run tries again.
+func burnAccount(ctx context.Context, profile string, account *storage.AccountData) error {
+	client, err := newClient(account)
+	if err != nil {
+		return err
+	}
+
+	_, err = retryWithBackoff(ctx, func() (interface{}, error) {
+		return nil, client.DeleteAccount(ctx, account.AccountID)
+	})
+	if err != nil && !accountGone(err) {
+		return err
+	}
+
+	for _, path := range account.Downloads {
+		_ = os.Remove(path)
+	}
+	if cacheFile, err := storage.CachePath(profile); err == nil {
+		_ = os.Remove(cacheFile)
+	}
+	// Before the account file, which would otherwise take the secret of
+	// the archive with it.
+	if err := storage.PurgeArchive(profile, account.AccountID); err != nil {
+		return err
+	}
+	if err := storage.DeleteProfile(profile); err != nil {
+		return err
+	}
+	forgetProfile(profile)
+	return nil
+}
+
+// accountGone reports whether deleting an account failed because the server
+// has already dropped it: the account is not found, or its credentials no
+// longer log in. A failed re-login for any other reason, like a network
+// error or a rate limit, says nothing about the account.
+func accountGone(err error) bool {
+	var refreshErr *api.TokenRefreshError
+	if errors.As(err, &refreshErr) {
+		return errors.Is(refreshErr.Err, api.ErrUnauthorized) || errors.Is(refreshErr.Err, api.ErrNotFound)
+	}
+	return errors.Is(err, api.ErrNotFound)
+}
+
+// rememberDownload adds an attachment saved from the TUI to the account, so
+// that it is deleted along with the account once its TTL runs out.
+func rememberDownload(accountID, path string) tea.Cmd {
+	return func() tea.Msg {
+		_ = storage.Update(func(saved *storage.AccountData) error {
+			if saved.AccountID != accountID {
+				return errUnchanged
+			}
+			saved.Downloads = append(saved.Downloads, path)
+			return nil
+		})
+		return nil
+	}
+}
+
+// expiryNotice counts down to when the account is burned, or "" when it
+// has no TTL.
+func expiryNotice(account *storage.AccountData) string {
+	if account.ExpiresAt.IsZero() {
+		return ""
+	}
+	left := time.Until(account.ExpiresAt)
+	if left <= 0 {
+		return "expired, burned on the next run"
+	}
+	return "burns in " + formatRemaining(left)
+}
+
+type countdownMsg struct{}
+
+// countdownCmd wakes the TUI when the expiry countdown next changes, every
+// minute and then every second during the last one.
+func countdownCmd(expires time.Time) tea.Cmd {
+	if expires.IsZero() {
+		return nil
+	}
+	left := time.Until(expires)
+	if left <= 0 {
+		return nil
+	}
+
+	wait := left % time.Minute
+	if left <= time.Minute || wait == 0 {
+		wait = min(time.Second, left)
+	}
+	return tea.Tick(wait, func(time.Time) tea.Msg {
+		return countdownMsg{}
+	})
+}
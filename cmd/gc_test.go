@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"burnmail/api"
+	"burnmail/api/apitest"
+	"burnmail/storage"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestCollectExpiredBurnsOnlyExpiredAccounts(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("BURNMAIL_HOME", home)
+	t.Setenv(storage.PassphraseEnv, "")
+	// Plaintext keeps the test fast; the encryption has its own tests.
+	keyring.MockInitWithError(errors.New("no secret service"))
+	storage.SetInsecurePlaintext(true)
+	t.Cleanup(func() {
+		keyring.MockInit()
+		storage.SetInsecurePlaintext(false)
+		_ = storage.SetProfile(storage.DefaultProfile)
+	})
+
+	srv := apitest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	download := filepath.Join(home, "invoice.pdf")
+	if err := os.WriteFile(download, []byte("%PDF"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	save := func(profile, address string, expires time.Time, downloads ...string) {
+		t.Helper()
+		account := srv.AddAccount(address, "secret123")
+		if err := storage.SetProfile(profile); err != nil {
+			t.Fatal(err)
+		}
+		err := storage.Save(&storage.AccountData{
+			Address:   address,
+			Password:  "secret123",
+			AccountID: account.ID,
+			APIURL:    srv.URL,
+			ExpiresAt: expires,
+			Downloads: downloads,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("old", "old@"+apitest.DefaultDomain, time.Now().Add(-time.Minute), download)
+	save("live", "live@"+apitest.DefaultDomain, time.Now().Add(time.Hour))
+	save("forever", "forever@"+apitest.DefaultDomain, time.Time{})
+	_ = storage.SetProfile(storage.DefaultProfile)
+
+	if expired, err := storage.ExpiredProfiles(time.Now()); err != nil || strings.Join(expired, ",") != "old" {
+		t.Fatalf("ExpiredProfiles() = %v, %v; want [old]", expired, err)
+	}
+
+	collectExpired(ctx)
+
+	if profiles, _ := storage.ListProfiles(); strings.Join(profiles, ",") != "forever,live" {
+		t.Errorf("profiles left = %v, want forever and live", profiles)
+	}
+	if _, err := os.Stat(download); !os.IsNotExist(err) {
+		t.Error("the attachment saved from the expired account should be deleted")
+	}
+	if _, err := srv.Client().Login(ctx, "old@"+apitest.DefaultDomain, "secret123"); err == nil {
+		t.Error("the expired account should be deleted on the server")
+	}
+	if _, err := srv.Client().Login(ctx, "live@"+apitest.DefaultDomain, "secret123"); err != nil {
+		t.Errorf("the live account should be kept on the server: %v", err)
+	}
+	if expired, _ := storage.ExpiredProfiles(time.Now().Add(2 * time.Hour)); strings.Join(expired, ",") != "live" {
+		t.Errorf("ExpiredProfiles() in two hours = %v, want only live left in the index", expired)
+	}
+}
+
+func TestBurnAccountPurgesItsArchive(t *testing.T) {
+	t.Setenv("BURNMAIL_HOME", t.TempDir())
+	keyring.MockInit()
+
+	srv := apitest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	address := "ttl@" + apitest.DefaultDomain
+	account := srv.AddAccount(address, "secret123")
+	id, err := srv.Deliver(address, apitest.Message{Subject: "one-time code"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accountData := &storage.AccountData{Address: address, Password: "secret123", AccountID: account.ID, APIURL: srv.URL}
+	if err := storage.Save(accountData); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openMailboxOrExit(accountData).GetMessage(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if archives, _ := storage.ListArchives(storage.Profile()); len(archives) != 1 {
+		t.Fatalf("archives = %v, want the one just written", archives)
+	}
+
+	if err := burnAccount(ctx, storage.Profile(), accountData); err != nil {
+		t.Fatal(err)
+	}
+	if archives, _ := storage.ListArchives(storage.Profile()); len(archives) != 0 {
+		t.Errorf("archives left = %v, want none after the TTL burn", archives)
+	}
+	if _, err := keyring.Get("burnmail", storage.Profile()); !errors.Is(err, keyring.ErrNotFound) {
+		t.Errorf("the key of the profile should be deleted too: %v", err)
+	}
+}
+
+func TestAccountGone(t *testing.T) {
+	rejected := &api.APIError{StatusCode: http.StatusUnauthorized}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"not found", &api.APIError{StatusCode: http.StatusNotFound}, true},
+		{"login rejected", &api.TokenRefreshError{Rejected: rejected, Err: &api.APIError{StatusCode: http.StatusUnauthorized}}, true},
+		{"login rate limited", &api.TokenRefreshError{Rejected: rejected, Err: &api.APIError{StatusCode: http.StatusTooManyRequests}}, false},
+		{"login unreachable", &api.TokenRefreshError{Rejected: rejected, Err: errors.New("connection refused")}, false},
+		{"rejected without login", rejected, false},
+	}
+
+	for _, tt := range tests {
+		if got := accountGone(tt.err); got != tt.want {
+			t.Errorf("accountGone(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExpiryNotice(t *testing.T) {
+	tests := []struct {
+		expires time.Time
+		want    string
+	}{
+		{time.Time{}, ""},
+		{time.Now().Add(90*time.Minute + 30*time.Second), "burns in 1h 30m"},
+		{time.Now().Add(-time.Second), "expired, burned on the next run"},
+	}
+
+	for _, tt := range tests {
+		if got := expiryNotice(&storage.AccountData{ExpiresAt: tt.expires}); got != tt.want {
+			t.Errorf("expiryNotice(%v) = %q, want %q", tt.expires, got, tt.want)
+		}
+	}
+}
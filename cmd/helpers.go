@@ -5,8 +5,8 @@ import (
 	"burnmail/storage"
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
-	"math"
 	"os"
 	"os/exec"
 	"runtime"
@@ -14,16 +14,132 @@ import (
 	"time"
 )
 
+// errUnchanged aborts a storage.Update or storage.UpdateConfig that turns
+// out to have nothing to write.
+var errUnchanged = errors.New("nothing to change")
+
 // loadAccountOrExit loads account data or exits with error message
 func loadAccountOrExit() *storage.AccountData {
 	accountData, err := storage.Load()
-	if err != nil || accountData == nil {
-		fmt.Printf("%s No account found. Generate one first with '%s'\n", red("✗"), yellow("burnmail g"))
+	if err != nil {
+		printFailure("load account", err)
+		return nil
+	}
+	if accountData == nil {
+		fmt.Printf("%s No account found. Generate one first with '%s'\n", red("✗"), yellow(profileArgs("burnmail g")))
 		return nil
 	}
 	return accountData
 }
 
+// protectionLabel describes how an account is stored on disk
+func protectionLabel(p storage.Protection) string {
+	switch p {
+	case storage.ProtectionKeyring:
+		return "encrypted, key in the OS keyring"
+	case storage.ProtectionPassphrase:
+		return "encrypted with a passphrase"
+	case storage.ProtectionEnv:
+		return "encrypted, key from an environment variable"
+	case storage.ProtectionFile:
+		return "encrypted, key from a file"
+	case storage.ProtectionCommand:
+		return "encrypted, key from a command"
+	case storage.ProtectionPlaintext:
+		return "not encrypted"
+	}
+	return string(p)
+}
+
+// newClient returns the API client pointed at the right provider. Flags win,
+// then the service the account was created on, then the config file. Proxy
+// and CA settings come from flags, then the config file, then the
+// environment.
+func newClient(accountData *storage.AccountData) (*api.Client, error) {
+	cfg, err := storage.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %v", err)
+	}
+
+	var saved api.ProviderSetting
+	if accountData != nil {
+		saved.APIURL = accountData.APIURL
+	}
+	baseURL, err := api.ResolveFirst(
+		api.ProviderSetting{Provider: providerFlag, APIURL: apiURLFlag},
+		saved,
+		api.ProviderSetting{Provider: cfg.Provider, APIURL: cfg.APIURL},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := api.NewTransport(api.TransportConfig{
+		ProxyURL:   firstNonEmpty(proxyFlag, cfg.Proxy),
+		CACertFile: firstNonEmpty(caCertFlag, cfg.CACert),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []api.Option{
+		api.WithBaseURL(baseURL),
+		api.WithTransport(transport),
+		api.WithUserAgent(userAgent()),
+	}
+	if accountData != nil {
+		opts = append(opts, api.WithToken(accountData.Token))
+	}
+	if logger := getDebugLogger(); logger != nil {
+		opts = append(opts, api.WithLogger(logger))
+	}
+
+	client := api.NewClient(opts...)
+	if accountData != nil {
+		client.SetCredentials(accountData.Address, accountData.Password)
+		client.OnTokenRefresh(func(token string) {
+			accountData.Token = token
+			// Write only the token, into whatever is on disk now, and not
+			// over an account another process has put in its place.
+			_ = storage.Update(func(saved *storage.AccountData) error {
+				if saved.AccountID != accountData.AccountID {
+					return errUnchanged
+				}
+				saved.Token = token
+				return nil
+			})
+		})
+	}
+	return client, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// userAgent identifies burnmail and its version to the mail service
+func userAgent() string {
+	if Version == "" {
+		return api.DefaultUserAgent
+	}
+	return api.DefaultUserAgent + "/" + Version
+}
+
+// newClientOrExit is newClient with the error printed for the user
+func newClientOrExit(accountData *storage.AccountData) *api.Client {
+	client, err := newClient(accountData)
+	if err != nil {
+		fmt.Printf("%s %v\n", red("✗"), err)
+		return nil
+	}
+	return client
+}
+
 // generateRandomString generates a random string of specified length
 func generateRandomString(length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
@@ -37,6 +153,46 @@ func generateRandomString(length int) string {
 	return string(bytes)
 }
 
+// formatBytes renders a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatRemaining renders a duration coarsely, e.g. "3d", "5h 20m" or "12m"
+func formatRemaining(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh %02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%ds", max(int(d.Seconds()), 0))
+}
+
+// tokenExpiry describes when the client's token expires, or "" when the
+// token carries no expiry
+func tokenExpiry(client *api.Client) string {
+	exp := client.TokenExpiresAt()
+	if exp.IsZero() {
+		return ""
+	}
+	if time.Until(exp) <= 0 {
+		return "expired " + exp.Local().Format("02/01/2006 15:04")
+	}
+	return fmt.Sprintf("expires in %s (%s)", formatRemaining(time.Until(exp)), exp.Local().Format("02/01/2006 15:04"))
+}
+
 // openInBrowser opens HTML content in the default browser
 func openInBrowser(message *api.MessageDetail) {
 	tmpFile, err := os.CreateTemp("", "burnmail-*.html")
@@ -80,7 +236,9 @@ func openInBrowser(message *api.MessageDetail) {
 	}
 }
 
-// retryWithBackoff retries a function with exponential backoff
+// retryWithBackoff retries a function rejected with 429. The client pauses
+// every request until the server's back-off has passed, so the retry itself
+// waits in the rate limiter rather than here.
 func retryWithBackoff(ctx context.Context, fn func() (any, error)) (any, error) {
 	for attempt := 0; attempt < retryMaxAttempts; attempt++ {
 		select {
@@ -94,22 +252,39 @@ func retryWithBackoff(ctx context.Context, fn func() (any, error)) (any, error)
 			return result, nil
 		}
 
-		if attempt == retryMaxAttempts-1 {
+		if attempt == retryMaxAttempts-1 || !errors.Is(err, api.ErrRateLimited) {
 			return nil, err
 		}
+	}
 
-		if strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "rate limit") {
-			delay := min(time.Duration(math.Pow(2, float64(attempt)))*retryBaseDelay, retryMaxDelay)
+	return nil, fmt.Errorf("max retries exceeded")
+}
 
-			select {
-			case <-time.After(delay):
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			}
-		} else {
-			return nil, err
-		}
+// errorHint suggests what the user can do about an API error, if anything
+func errorHint(err error) string {
+	switch {
+	case errors.Is(err, api.ErrUnauthorized):
+		return "The server rejected the saved credentials. The account may no longer exist; start over with 'burnmail d && burnmail g'."
+	case errors.Is(err, api.ErrRateLimited):
+		return "Rate limit exceeded. Wait a few minutes and try again."
+	case errors.Is(err, errNotArchived):
+		return "Only messages read or exported online are archived; go online to fetch it."
+	case errors.Is(err, api.ErrNotFound):
+		return "Not found on the server. It may have been deleted."
+	case errors.Is(err, api.ErrAddressTaken):
+		return "That address is already in use."
+	case errors.Is(err, storage.ErrPlaintext):
+		return "Encrypt it with 'burnmail keyring migrate keyring', or 'passphrase' where there is no keyring, or pass --insecure-plaintext to use it as is."
+	case errors.Is(err, storage.ErrNoProtection):
+		return "Set BURNMAIL_PASSPHRASE, run in a terminal to be asked for a passphrase, or pass --insecure-plaintext to store the account unencrypted."
 	}
+	return ""
+}
 
-	return nil, fmt.Errorf("max retries exceeded")
+// printFailure reports a failed operation along with a hint when one applies
+func printFailure(what string, err error) {
+	fmt.Printf("%s Failed to %s: %v\n", red("✗"), what, err)
+	if hint := errorHint(err); hint != "" {
+		fmt.Printf("  %s\n", yellow(hint))
+	}
 }
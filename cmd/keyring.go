@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"burnmail/storage"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// setupSecretStore selects the secret store named in the config file
+func setupSecretStore() error {
+	cfg, err := storage.LoadConfig()
+	if err != nil {
+		// newClient reports a broken config file in context.
+		return nil
+	}
+
+	store, err := storage.NewSecretStore(cfg.Secrets)
+	if err != nil {
+		return fmt.Errorf("config file: %v", err)
+	}
+	storage.SetSecretStore(store)
+	return nil
+}
+
+func migrateSecrets(_ *cobra.Command, args []string) {
+	to := &storage.SecretsConfig{
+		Store:   args[0],
+		Env:     secretEnvFlag,
+		File:    secretFileFlag,
+		Command: secretCommandFlag,
+	}
+
+	if to.File != "" {
+		if abs, err := filepath.Abs(to.File); err == nil {
+			to.File = abs
+		}
+	}
+
+	moved, err := storage.MigrateSecrets(to)
+	for _, profile := range moved {
+		fmt.Printf("%s Profile %s now uses the %s secret store\n", green("✓"), cyan(profile), to.Store)
+	}
+	if err != nil {
+		fmt.Printf("%s Failed to migrate: %v\n", red("✗"), err)
+		return
+	}
+
+	if len(moved) == 0 {
+		fmt.Printf("%s No accounts to migrate; new ones will use the %s secret store\n", green("✓"), to.Store)
+	}
+}
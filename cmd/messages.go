@@ -4,22 +4,27 @@ import (
 	"burnmail/api"
 	"context"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 )
 
-func viewMessages(_ *cobra.Command, _ []string) {
-	accountData := loadAccountOrExit()
+func viewMessages(cmd *cobra.Command, _ []string) {
+	accountData := mailAccountOrExit()
 	if accountData == nil {
 		return
 	}
 
-	client := api.GetClient()
-	client.SetToken(accountData.Token)
+	client := openMailboxOrExit(accountData)
+	if client == nil {
+		return
+	}
+
+	ctx := cmd.Context()
 
-	messages, success := fetchMessages(client)
+	messages, success := fetchMessages(ctx, client)
 	if !success {
 		return
 	}
@@ -31,8 +36,8 @@ func viewMessages(_ *cobra.Command, _ []string) {
 
 	templates := &promptui.SelectTemplates{
 		Label:    "{{ . }}",
-		Active:   "▸ {{ .Subject | cyan }} - from {{ .From.Address | yellow }}",
-		Inactive: "  {{ .Subject | cyan }} - from {{ .From.Address | yellow }}",
+		Active:   "▸ {{ if .Flagged }}⚑ {{ end }}{{ .Subject | cyan }} - from {{ .From.Address | yellow }}",
+		Inactive: "  {{ if .Flagged }}⚑ {{ end }}{{ .Subject | cyan }} - from {{ .From.Address | yellow }}",
 		Selected: "{{ .Subject | green }}",
 	}
 
@@ -51,9 +56,9 @@ func viewMessages(_ *cobra.Command, _ []string) {
 	selectedMessage := messages[idx]
 
 	fmt.Println(cyan("\n📖 Loading message..."))
-	fullMessage, err := client.GetMessage(selectedMessage.ID)
+	fullMessage, err := client.GetMessage(ctx, selectedMessage.ID)
 	if err != nil {
-		fmt.Printf("%s Failed to get message: %v\n", red("✗"), err)
+		printFailure("get message", err)
 		return
 	}
 
@@ -61,6 +66,7 @@ func viewMessages(_ *cobra.Command, _ []string) {
 	fmt.Printf("%s: %s\n", cyan("From"), fullMessage.From.Address)
 	fmt.Printf("%s: %s\n", cyan("Subject"), fullMessage.Subject)
 	fmt.Printf("%s: %s\n", cyan("Date"), fullMessage.CreatedAt.Format("02/01/2006 15:04:05"))
+	fmt.Printf("%s: %s\n", cyan("ID"), fullMessage.ID)
 	fmt.Printf("%s\n\n", strings.Repeat("─", 60))
 
 	if fullMessage.Text != "" {
@@ -71,32 +77,129 @@ func viewMessages(_ *cobra.Command, _ []string) {
 	}
 
 	fmt.Println()
+	finishArchiving(ctx, client)
+}
+
+func viewMessageSource(cmd *cobra.Command, args []string) {
+	accountData := mailAccountOrExit()
+	if accountData == nil {
+		return
+	}
+
+	client := openMailboxOrExit(accountData)
+	if client == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), requestTimeout)
+	defer cancel()
+
+	source, err := client.GetMessageSource(ctx, args[0])
+	if err != nil {
+		printFailure("get message source", err)
+		return
+	}
+
+	if rawOutput == "" {
+		_, _ = os.Stdout.Write(source)
+		return
+	}
+
+	if err := os.WriteFile(rawOutput, source, 0600); err != nil {
+		fmt.Printf("%s Failed to write %s: %v\n", red("✗"), rawOutput, err)
+		return
+	}
+	fmt.Printf("%s Source saved to %s\n", green("✓"), rawOutput)
 }
 
-func viewMessagesTUI(_ *cobra.Command, _ []string) {
-	accountData := loadAccountOrExit()
+func markMessages(cmd *cobra.Command, args []string) {
+	accountData := mailAccountOrExit()
 	if accountData == nil {
 		return
 	}
 
-	client := api.GetClient()
+	client := openMailboxOrExit(accountData)
+	if client == nil {
+		return
+	}
+
+	seen := boolChange(markRead, markUnread)
+	flagged := boolChange(markFlag, markUnflag)
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), requestTimeout)
+	defer cancel()
+
+	for _, id := range args {
+		_, err := retryWithBackoff(ctx, func() (interface{}, error) {
+			return nil, client.UpdateMessage(ctx, id, seen, flagged)
+		})
+		if err != nil {
+			printFailure("update message "+id, err)
+			continue
+		}
+		fmt.Printf("%s %s %s\n", green("✓"), id, describeChange(seen, flagged))
+	}
+}
+
+// boolChange turns a pair of opposite flags into the value to send, or nil
+// when neither was given.
+func boolChange(on, off bool) *bool {
+	switch {
+	case on:
+		return &on
+	case off:
+		value := false
+		return &value
+	}
+	return nil
+}
+
+func describeChange(seen, flagged *bool) string {
+	var parts []string
+	if seen != nil {
+		if *seen {
+			parts = append(parts, "marked as read")
+		} else {
+			parts = append(parts, "marked as unread")
+		}
+	}
+	if flagged != nil {
+		if *flagged {
+			parts = append(parts, "flagged")
+		} else {
+			parts = append(parts, "unflagged")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func viewMessagesTUI(cmd *cobra.Command, _ []string) {
+	accountData := mailAccountOrExit()
+	if accountData == nil {
+		return
+	}
+
+	client := openMailboxOrExit(accountData)
+	if client == nil {
+		return
+	}
 
-	if err := runTUI(accountData, client); err != nil {
+	if err := runTUI(cmd.Context(), accountData, client); err != nil {
 		fmt.Printf("%s TUI error: %v\n", red("✗"), err)
 	}
 }
 
-func fetchMessages(client *api.Client) ([]api.Message, bool) {
+func fetchMessages(parent context.Context, client api.Provider) ([]api.Message, bool) {
 	fmt.Println(cyan("📬 Fetching messages..."))
 
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	ctx, cancel := context.WithTimeout(parent, requestTimeout)
 	defer cancel()
 
 	result, err := retryWithBackoff(ctx, func() (interface{}, error) {
-		return client.GetMessages()
+		return client.GetAllMessages(ctx)
 	})
 	if err != nil {
-		fmt.Printf("%s Failed to get messages: %v\n", red("✗"), err)
+		printFailure("get messages", err)
 		return nil, false
 	}
 
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/manifoldco/promptui"
+	"github.com/mattn/go-isatty"
+)
+
+const minPassphraseLength = 8
+
+// promptPassphrase asks on the terminal for the passphrase protecting a
+// profile. Prompts go to stderr so piped output stays clean.
+func promptPassphrase(profile string, confirm bool) (string, error) {
+	if confirm {
+		fmt.Fprintf(os.Stderr, "%s No keyring available; choose a passphrase to encrypt profile %s.\n", yellow("⚠"), profile)
+		if insecurePlaintext {
+			fmt.Fprintf(os.Stderr, "Leave it empty to store the account unencrypted.\n")
+		}
+	}
+
+	prompt := promptui.Prompt{
+		Label:  fmt.Sprintf("Passphrase for profile %s", profile),
+		Mask:   '*',
+		Stdout: os.Stderr,
+	}
+	if confirm {
+		prompt.Validate = validatePassphrase(insecurePlaintext)
+	}
+
+	passphrase, err := prompt.Run()
+	// An empty answer declines, which storage takes as no passphrase.
+	if err != nil || !confirm || passphrase == "" {
+		return passphrase, err
+	}
+
+	repeat := promptui.Prompt{Label: "Repeat passphrase", Mask: '*', Stdout: os.Stderr}
+	again, err := repeat.Run()
+	if err != nil {
+		return "", err
+	}
+	if again != passphrase {
+		return "", errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// validatePassphrase checks a new passphrase. An empty one is accepted when
+// plaintext storage is allowed, to decline encryption.
+func validatePassphrase(allowEmpty bool) func(string) error {
+	return func(s string) error {
+		if s == "" && allowEmpty {
+			return nil
+		}
+		if len(s) < minPassphraseLength {
+			return fmt.Errorf("use at least %d characters", minPassphraseLength)
+		}
+		return nil
+	}
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
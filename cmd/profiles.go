@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"burnmail/storage"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// selectProfile picks the profile every command works on: --profile, then
+// BURNMAIL_PROFILE, then the one chosen with 'burnmail use'.
+func selectProfile(cmd *cobra.Command, _ []string) error {
+	name := firstNonEmpty(profileFlag, os.Getenv("BURNMAIL_PROFILE"))
+	if name == "" {
+		if cfg, err := storage.LoadConfig(); err == nil {
+			name = cfg.Profile
+		}
+	}
+	if name == "" {
+		name = storage.DefaultProfile
+	}
+
+	if err := storage.SetProfile(name); err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+	return nil
+}
+
+// profileArgs adds --profile to a suggested command when a profile other
+// than the default is selected.
+func profileArgs(command string) string {
+	if profile := storage.Profile(); profile != storage.DefaultProfile {
+		return command + " --profile " + profile
+	}
+	return command
+}
+
+func listAccounts(_ *cobra.Command, _ []string) {
+	profiles, err := storage.ListProfiles()
+	if err != nil {
+		fmt.Printf("%s Failed to list accounts: %v\n", red("✗"), err)
+		return
+	}
+	if len(profiles) == 0 {
+		fmt.Printf("%s No accounts yet. Generate one with '%s'\n", yellow("⚠"), yellow("burnmail g"))
+		return
+	}
+
+	fmt.Println()
+	for _, name := range profiles {
+		marker := " "
+		if name == storage.Profile() {
+			marker = green("●")
+		}
+
+		account, err := storage.LoadProfile(name)
+		switch {
+		case err != nil:
+			fmt.Printf("  %s %-16s %s\n", marker, name, red("unreadable: "+err.Error()))
+		case account == nil:
+			fmt.Printf("  %s %-16s %s\n", marker, name, yellow("(empty)"))
+		default:
+			fmt.Printf("  %s %-16s %s  %s\n", marker, name, cyan(account.Address), account.CreatedAt)
+		}
+	}
+	fmt.Printf("\nSwitch with '%s'.\n\n", yellow("burnmail use <name>"))
+}
+
+func useProfile(_ *cobra.Command, args []string) {
+	name := args[0]
+	if err := storage.ValidateProfileName(name); err != nil {
+		fmt.Printf("%s %v\n", red("✗"), err)
+		return
+	}
+	if name != storage.DefaultProfile && !storage.ProfileExists(name) {
+		fmt.Printf("%s No account in profile %s. Create one with '%s'\n", red("✗"), name, yellow("burnmail g --profile "+name))
+		return
+	}
+
+	err := storage.UpdateConfig(func(cfg *storage.Config) error {
+		cfg.Profile = name
+		if name == storage.DefaultProfile {
+			cfg.Profile = ""
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("%s Failed to save config: %v\n", red("✗"), err)
+		return
+	}
+
+	fmt.Printf("%s Now using profile %s\n", green("✓"), cyan(name))
+}
+
+// forgetProfile stops pointing the config at a profile whose account was
+// deleted, so later commands fall back to the default profile.
+func forgetProfile(name string) {
+	_ = storage.UpdateConfig(func(cfg *storage.Config) error {
+		if cfg.Profile != name {
+			return errUnchanged
+		}
+		cfg.Profile = ""
+		return nil
+	})
+}
@@ -3,7 +3,9 @@ package cmd
 import (
 	"burnmail/api"
 	"burnmail/storage"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,6 +14,7 @@ import (
 	"strings"
 	"time"
 
+	"charm.land/bubbles/v2/progress"
 	"charm.land/bubbles/v2/spinner"
 	"charm.land/bubbles/v2/table"
 	"charm.land/bubbles/v2/textinput"
@@ -31,9 +34,9 @@ const (
 )
 
 const (
-	autoRefreshInterval = 10 * time.Second
-	cacheFileName       = ".burnmail-cache.json"
-	cacheExpiry         = 5 * time.Minute
+	autoRefreshInterval  = 10 * time.Second
+	quotaRefreshInterval = time.Minute
+	cacheExpiry          = 5 * time.Minute
 )
 
 type sortMode int
@@ -50,6 +53,7 @@ type messageCache struct {
 }
 
 type model struct {
+	ctx            context.Context
 	table          table.Model
 	viewport       viewport.Model
 	searchInput    textinput.Model
@@ -62,8 +66,9 @@ type model struct {
 	selectedMsg    *api.MessageDetail
 	width          int
 	height         int
-	client         *api.Client
+	client         mailbox
 	accountData    *storage.AccountData
+	account        *api.Account
 	loading        bool
 	err            error
 	retryCount     int
@@ -77,14 +82,44 @@ type model struct {
 	confirmData    interface{}
 	lastUpdate     time.Time
 	isDark         bool
+	page           int
+	hasMore        bool
+	loadingMore    bool
+	totalItems     int
+	events         <-chan api.MessageEvent
+	showSource     bool
+	messageSources map[string]string
+	downloads      map[string]*download
+	progress       progress.Model
 }
 
-type messagesLoadedMsg []api.Message
+type messagesLoadedMsg *api.MessagesPage
+type accountLoadedMsg *api.Account
+type morePagesLoadedMsg *api.MessagesPage
+type morePagesErrMsg struct{ err error }
 type messageDetailLoadedMsg *api.MessageDetail
 type messageDeletedMsg struct{}
 type bulkDeletedMsg struct{}
 type errMsg error
 type tickMsg time.Time
+type quotaTickMsg struct{}
+type subscribedMsg struct{ events <-chan api.MessageEvent }
+type subscribeFailedMsg struct{ err error }
+type newMailMsg api.MessageEvent
+type subscriptionClosedMsg struct{}
+type sourceLoadedMsg struct {
+	id     string
+	source string
+}
+type messageStateErrMsg struct {
+	id            string
+	seen, flagged *bool
+	err           error
+}
+type actionErrMsg struct {
+	action string
+	err    error
+}
 
 var (
 	baseStyle = lipgloss.NewStyle().
@@ -122,6 +157,12 @@ var (
 	descStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("#CCCCCC"))
 
+	successStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#00FF87"))
+
+	errorStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FF5F87"))
+
 	confirmBoxStyle = lipgloss.NewStyle().
 			Border(lipgloss.RoundedBorder()).
 			BorderForeground(lipgloss.Color("#FF6B9D")).
@@ -139,9 +180,11 @@ var (
 				Padding(0, 1)
 )
 
-func initialModel(accountData *storage.AccountData, client *api.Client) *model {
+func initialModel(ctx context.Context, accountData *storage.AccountData, client mailbox) *model {
 	columns := []table.Column{
 		{Title: "✓", Width: 3},
+		{Title: "●", Width: 2},
+		{Title: "⚑", Width: 2},
 		{Title: "📎", Width: 3},
 		{Title: "From", Width: 20},
 		{Title: "Subject", Width: 30},
@@ -179,6 +222,7 @@ func initialModel(accountData *storage.AccountData, client *api.Client) *model {
 	}
 
 	m := &model{
+		ctx:            ctx,
 		table:          t,
 		viewport:       vp,
 		searchInput:    ti,
@@ -191,6 +235,9 @@ func initialModel(accountData *storage.AccountData, client *api.Client) *model {
 		filteredMsgs:   msgs,
 		messages:       msgs,
 		messageDetails: make(map[string]*api.MessageDetail),
+		messageSources: make(map[string]string),
+		downloads:      make(map[string]*download),
+		progress:       progress.New(progress.WithWidth(30), progress.WithDefaultBlend()),
 		selectedItems:  make(map[int]bool),
 		sortBy:         sortByDate,
 	}
@@ -200,43 +247,133 @@ func initialModel(accountData *storage.AccountData, client *api.Client) *model {
 
 func (m *model) Init() tea.Cmd {
 	return tea.Batch(
-		loadMessages(m.client),
-		tickCmd(),
+		loadMessages(m.ctx, m.client),
+		loadAccount(m.ctx, m.client),
+		quotaTickCmd(),
+		subscribe(m.ctx, m.client, m.accountData.AccountID),
 		m.spinner.Tick,
+		countdownCmd(m.accountData.ExpiresAt),
 		tea.RequestBackgroundColor,
 	)
 }
 
+// quotaTickCmd schedules the next quota refresh. Besides this, the quota is
+// only fetched again after new mail and deletes.
+func quotaTickCmd() tea.Cmd {
+	return tea.Tick(quotaRefreshInterval, func(time.Time) tea.Msg {
+		return quotaTickMsg{}
+	})
+}
+
+// hasNewMessages reports whether page holds a message that is not in known.
+func hasNewMessages(page, known []api.Message) bool {
+	ids := make(map[string]bool, len(known))
+	for _, message := range known {
+		ids[message.ID] = true
+	}
+	for _, message := range page {
+		if !ids[message.ID] {
+			return true
+		}
+	}
+	return false
+}
+
 func tickCmd() tea.Cmd {
 	return tea.Tick(autoRefreshInterval, func(t time.Time) tea.Msg {
 		return tickMsg(t)
 	})
 }
 
-func loadMessages(client *api.Client) tea.Cmd {
+// subscribe opens the push channel for new mail. On failure the model falls
+// back to polling with tickCmd.
+func subscribe(ctx context.Context, client mailbox, accountID string) tea.Cmd {
 	return func() tea.Msg {
-		messages, err := client.GetMessages()
+		events, err := client.Subscribe(ctx, accountID)
+		if err != nil {
+			return subscribeFailedMsg{err: err}
+		}
+		return subscribedMsg{events: events}
+	}
+}
+
+func waitForEvent(events <-chan api.MessageEvent) tea.Cmd {
+	return func() tea.Msg {
+		event, ok := <-events
+		if !ok {
+			return subscriptionClosedMsg{}
+		}
+		return newMailMsg(event)
+	}
+}
+
+func loadMessages(ctx context.Context, client mailbox) tea.Cmd {
+	return func() tea.Msg {
+		page, err := client.GetMessagesPage(ctx, 1)
 		if err != nil {
 			return errMsg(err)
 		}
-		return messagesLoadedMsg(messages)
+		return messagesLoadedMsg(page)
+	}
+}
+
+// loadAccount fetches quota and usage. Failures are ignored; the warning it
+// feeds is not worth interrupting the inbox for.
+func loadAccount(ctx context.Context, client mailbox) tea.Cmd {
+	return func() tea.Msg {
+		account, err := client.GetMe(ctx)
+		if err != nil {
+			return accountLoadedMsg(nil)
+		}
+		return accountLoadedMsg(account)
 	}
 }
 
-func loadMessageDetail(client *api.Client, id string) tea.Cmd {
+func loadMorePages(ctx context.Context, client mailbox, page int) tea.Cmd {
 	return func() tea.Msg {
-		message, err := client.GetMessage(id)
+		result, err := client.GetMessagesPage(ctx, page)
+		if err != nil {
+			return morePagesErrMsg{err: err}
+		}
+		return morePagesLoadedMsg(result)
+	}
+}
+
+func loadMessageDetail(ctx context.Context, client mailbox, id string) tea.Cmd {
+	return func() tea.Msg {
+		message, err := client.GetMessage(ctx, id)
 		if err != nil {
 			return errMsg(err)
 		}
-		_ = client.MarkMessageAsRead(id)
+		_ = client.MarkMessageAsRead(ctx, id)
 		return messageDetailLoadedMsg(message)
 	}
 }
 
-func deleteMessage(client *api.Client, id string) tea.Cmd {
+// updateMessageState sends a read/flag change. On failure it carries the
+// previous state back so the model can restore it.
+func updateMessageState(ctx context.Context, client mailbox, id string, seen, flagged, prevSeen, prevFlagged *bool) tea.Cmd {
+	return func() tea.Msg {
+		if err := client.UpdateMessage(ctx, id, seen, flagged); err != nil {
+			return messageStateErrMsg{id: id, seen: prevSeen, flagged: prevFlagged, err: err}
+		}
+		return nil
+	}
+}
+
+func loadMessageSource(ctx context.Context, client mailbox, id string) tea.Cmd {
 	return func() tea.Msg {
-		err := client.DeleteMessage(id)
+		source, err := client.GetMessageSource(ctx, id)
+		if err != nil {
+			return actionErrMsg{action: "load message source", err: err}
+		}
+		return sourceLoadedMsg{id: id, source: string(source)}
+	}
+}
+
+func deleteMessage(ctx context.Context, client mailbox, id string) tea.Cmd {
+	return func() tea.Msg {
+		err := client.DeleteMessage(ctx, id)
 		if err != nil {
 			return errMsg(err)
 		}
@@ -244,7 +381,7 @@ func deleteMessage(client *api.Client, id string) tea.Cmd {
 	}
 }
 
-func bulkDeleteMessages(client *api.Client, ids []string) tea.Cmd {
+func bulkDeleteMessages(ctx context.Context, client mailbox, ids []string) tea.Cmd {
 	return func() tea.Msg {
 		type result struct {
 			err error
@@ -253,7 +390,7 @@ func bulkDeleteMessages(client *api.Client, ids []string) tea.Cmd {
 
 		for _, id := range ids {
 			go func(msgID string) {
-				err := client.DeleteMessage(msgID)
+				err := client.DeleteMessage(ctx, msgID)
 				results <- result{err: err}
 			}(id)
 		}
@@ -299,23 +436,139 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case messagesLoadedMsg:
-		m.messages = msg
+		// The quota only changes with new mail; otherwise quotaTickMsg
+		// keeps it fresh.
+		var refreshQuota tea.Cmd
+		if hasNewMessages(msg.Messages, m.messages) {
+			refreshQuota = loadAccount(m.ctx, m.client)
+		}
+		if m.page > 1 {
+			m.messages = mergeFirstPage(msg.Messages, m.messages)
+		} else {
+			m.messages = msg.Messages
+			m.page = 1
+			m.hasMore = msg.HasNext
+		}
+		m.totalItems = msg.TotalItems
 		m.loading = false
 		m.retryCount = 0
 		m.lastUpdate = time.Now()
 		saveCache(m.messages)
 		m.refreshTable()
+		archiveMessages(m.client, msg.Messages)
+		return m, refreshQuota
+
+	case accountLoadedMsg:
+		if msg != nil {
+			m.account = msg
+		}
+		return m, nil
+
+	case quotaTickMsg:
+		return m, tea.Batch(loadAccount(m.ctx, m.client), quotaTickCmd())
+
+	case subscribedMsg:
+		m.events = msg.events
+		return m, waitForEvent(m.events)
+
+	case subscribeFailedMsg:
 		return m, tickCmd()
 
+	case subscriptionClosedMsg:
+		m.events = nil
+		if m.ctx.Err() != nil {
+			return m, nil
+		}
+		m.statusMessage = "Live updates lost, polling every " + autoRefreshInterval.String()
+		return m, tickCmd()
+
+	case newMailMsg:
+		// With auto-refresh off the list only changes on a manual refresh.
+		if !m.autoRefresh {
+			return m, waitForEvent(m.events)
+		}
+		var refreshQuota tea.Cmd
+		if m.upsertMessage(msg.Message) {
+			m.statusMessage = fmt.Sprintf("New message from %s", msg.Message.From.Address)
+			refreshQuota = loadAccount(m.ctx, m.client)
+		}
+		saveCache(m.messages)
+		m.refreshTable()
+		archiveMessages(m.client, []api.Message{msg.Message})
+		return m, tea.Batch(waitForEvent(m.events), refreshQuota)
+
+	case morePagesLoadedMsg:
+		m.loadingMore = false
+		m.page = msg.Page
+		m.hasMore = msg.HasNext
+		m.totalItems = msg.TotalItems
+
+		known := make(map[string]bool, len(m.messages))
+		for _, existing := range m.messages {
+			known[existing.ID] = true
+		}
+		for _, message := range msg.Messages {
+			if !known[message.ID] {
+				m.messages = append(m.messages, message)
+			}
+		}
+		m.statusMessage = fmt.Sprintf("Loaded page %d", msg.Page)
+		saveCache(m.messages)
+		m.refreshTable()
+		archiveMessages(m.client, msg.Messages)
+		return m, nil
+
+	case morePagesErrMsg:
+		m.loadingMore = false
+		m.statusMessage = fmt.Sprintf("Failed to load more messages: %v", msg.err)
+		return m, nil
+
 	case messageDetailLoadedMsg:
 		m.selectedMsg = msg
 		m.messageDetails[m.selectedMsg.ID] = m.selectedMsg
 		m.currentView = detailView
+		m.showSource = false
 		m.loading = false
-		m.updateMessageSeen(m.selectedMsg.ID, true)
+		seen := true
+		m.applyMessageState(m.selectedMsg.ID, &seen, nil)
 		m.viewport.SetContent(m.renderMessageDetail(m.selectedMsg))
 		return m, nil
 
+	case sourceLoadedMsg:
+		m.loading = false
+		m.messageSources[msg.id] = msg.source
+		if m.selectedMsg != nil && m.selectedMsg.ID == msg.id {
+			m.showSource = true
+			m.viewport.SetContent(renderSource(msg.source))
+			m.viewport.GotoTop()
+		}
+		return m, nil
+
+	case downloadProgressMsg:
+		if d, ok := m.downloads[msg.key]; ok {
+			d.written = msg.written
+			if msg.total > 0 {
+				d.total = msg.total
+			}
+		}
+		return m, waitForDownload(msg.updates)
+
+	case downloadDoneMsg:
+		return m, m.handleDownloadDone(msg)
+
+	case countdownMsg:
+		return m, countdownCmd(m.accountData.ExpiresAt)
+
+	case messageStateErrMsg:
+		m.applyMessageState(msg.id, msg.seen, msg.flagged)
+		m.statusMessage = fmt.Sprintf("Failed to update message: %v", msg.err)
+		return m, nil
+
+	case actionErrMsg:
+		m.loading = false
+		m.statusMessage = fmt.Sprintf("Failed to %s: %v", msg.action, msg.err)
+		return m, nil
+
 	case bulkDeletedMsg:
 		deletedCount := len(m.selectedItems)
 		m.statusMessage = fmt.Sprintf("%d messages deleted", deletedCount)
@@ -334,12 +587,15 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 		m.messages = newMessages
+		if m.totalItems > 0 {
+			m.totalItems = max(m.totalItems-len(selectedIDs), 0)
+		}
 
 		m.selectedItems = make(map[int]bool)
 		m.bulkMode = false
 		m.refreshTable()
 		saveCache(m.messages)
-		return m, nil
+		return m, loadAccount(m.ctx, m.client)
 
 	case messageDeletedMsg:
 		m.statusMessage = "Message deleted"
@@ -350,28 +606,43 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			for i := range m.messages {
 				if m.messages[i].ID == msgID {
 					m.messages = append(m.messages[:i], m.messages[i+1:]...)
+					if m.totalItems > 0 {
+						m.totalItems--
+					}
 					break
 				}
 			}
 			m.refreshTable()
 			saveCache(m.messages)
 		}
-		return m, nil
+		return m, loadAccount(m.ctx, m.client)
 
 	case tickMsg:
+		if m.events != nil {
+			return m, nil
+		}
 		if m.autoRefresh && m.currentView == listView && !m.loading {
-			return m, tea.Batch(loadMessages(m.client), tickCmd())
+			return m, tea.Batch(loadMessages(m.ctx, m.client), tickCmd())
 		}
 		return m, tickCmd()
 
 	case errMsg:
 		m.loading = false
+		if errors.Is(msg, context.Canceled) {
+			return m, nil
+		}
+		if errors.Is(msg, errOffline) {
+			m.statusMessage = "Offline: reading from the archive, changes are not possible"
+			return m, nil
+		}
 		m.retryCount++
 
-		if m.retryCount < 3 {
+		// Retrying cannot fix a rejected token or a missing message.
+		retryable := !errors.Is(msg, api.ErrUnauthorized) && !errors.Is(msg, api.ErrNotFound)
+		if retryable && m.retryCount < 3 {
 			m.statusMessage = fmt.Sprintf("Error (retry %d/3): %v", m.retryCount, msg)
 			time.Sleep(time.Second * time.Duration(m.retryCount))
-			return m, loadMessages(m.client)
+			return m, loadMessages(m.ctx, m.client)
 		}
 
 		m.err = msg
@@ -384,6 +655,10 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case tea.KeyPressMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+
 		if m.currentView == confirmView {
 			switch msg.String() {
 			case "y", "Y":
@@ -417,7 +692,7 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.searchInput.Blur()
 				m.refreshTable()
 				m.statusMessage = "Refreshing..."
-				return m, loadMessages(m.client)
+				return m, loadMessages(m.ctx, m.client)
 			default:
 				var cmd tea.Cmd
 				m.searchInput, cmd = m.searchInput.Update(msg)
@@ -426,6 +701,26 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 		switch msg.String() {
+		case "q":
+			return m.showConfirm("quit", "quit")
+
+		case "?":
+			m.previousView = m.currentView
+			m.currentView = helpView
+			return m, nil
+
+		case "esc":
+			if m.currentView == detailView {
+				m.currentView = listView
+				return m, nil
+			}
+
+		case "r":
+			if m.currentView == listView && !m.loading {
+				m.statusMessage = "Refreshing..."
+				return m, loadMessages(m.ctx, m.client)
+			}
+
 		case "/":
 			if m.currentView == listView {
 				m.searchMode = true
@@ -506,12 +801,41 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					if cached, ok := m.messageDetails[msgID]; ok {
 						m.selectedMsg = cached
 						m.currentView = detailView
+						m.showSource = false
 						m.viewport.SetContent(m.renderMessageDetail(cached))
 						return m, nil
 					}
 					m.loading = true
-					return m, loadMessageDetail(m.client, msgID)
+					return m, loadMessageDetail(m.ctx, m.client, msgID)
+				}
+			}
+
+		case "R":
+			if m.currentView == detailView && m.selectedMsg != nil {
+				if m.showSource {
+					m.showSource = false
+					m.viewport.SetContent(m.renderMessageDetail(m.selectedMsg))
+					m.viewport.GotoTop()
+					return m, nil
+				}
+				if source, ok := m.messageSources[m.selectedMsg.ID]; ok {
+					m.showSource = true
+					m.viewport.SetContent(renderSource(source))
+					m.viewport.GotoTop()
+					return m, nil
 				}
+				m.statusMessage = "Loading message source..."
+				return m, loadMessageSource(m.ctx, m.client, m.selectedMsg.ID)
+			}
+
+		case "u":
+			if cmd := m.toggleMessageState(true); cmd != nil {
+				return m, cmd
+			}
+
+		case "f":
+			if cmd := m.toggleMessageState(false); cmd != nil {
+				return m, cmd
 			}
 
 		case "o":
@@ -525,23 +849,28 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.currentView == detailView && m.selectedMsg != nil && len(m.selectedMsg.Attachments) > 0 {
 				idx := int(msg.String()[0] - '1')
 				if idx < len(m.selectedMsg.Attachments) {
-					go downloadAttachment(m.client, m.selectedMsg.ID, m.selectedMsg.Attachments[idx])
 					m.statusMessage = fmt.Sprintf("Downloading %s...", m.selectedMsg.Attachments[idx].Filename)
+					return m, m.queueDownload(m.selectedMsg.Attachments[idx])
 				}
 			}
 
 		case "A":
 			if m.currentView == detailView && m.selectedMsg != nil && len(m.selectedMsg.Attachments) > 0 {
+				cmds := make([]tea.Cmd, 0, len(m.selectedMsg.Attachments))
 				for _, att := range m.selectedMsg.Attachments {
-					go downloadAttachment(m.client, m.selectedMsg.ID, att)
+					cmds = append(cmds, m.queueDownload(att))
 				}
 				m.statusMessage = fmt.Sprintf("Downloading %d attachments...", len(m.selectedMsg.Attachments))
+				return m, tea.Batch(cmds...)
 			}
 		}
 	}
 
 	if m.currentView == listView {
 		m.table, cmd = m.table.Update(msg)
+		if _, ok := msg.(tea.KeyPressMsg); ok {
+			cmd = tea.Batch(cmd, m.maybeLoadMore())
+		}
 	} else {
 		m.viewport, cmd = m.viewport.Update(msg)
 	}
@@ -555,9 +884,12 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m *model) View() tea.View {
 	var content string
 	if m.loading {
-		content = titleStyle.Render(fmt.Sprintf("%s Loading...", m.spinner.View())) + "\n"
+		content = titleStyle.Render(fmt.Sprintf("%s Loading...", m.spinner.View())) + "\n" + m.rateLimitNotice()
 	} else if m.err != nil {
 		content = titleStyle.Render("Error: ") + m.err.Error() + "\n"
+		if hint := errorHint(m.err); hint != "" {
+			content += helpStyle.Render(hint) + "\n"
+		}
 	} else {
 		var s strings.Builder
 
@@ -568,11 +900,22 @@ func (m *model) View() tea.View {
 				msgWord = "message"
 			}
 			title := fmt.Sprintf("Burnmail - %s (%d %s)", m.accountData.Address, msgCount, msgWord)
+			if m.totalItems > msgCount {
+				title = fmt.Sprintf("Burnmail - %s (%d of %d messages)", m.accountData.Address, msgCount, m.totalItems)
+			}
+			if notice := expiryNotice(m.accountData); notice != "" {
+				title += " • 🔥 " + notice
+			}
+			if _, offline := m.client.(*offlineMailbox); offline {
+				title += " • offline"
+			}
 			s.WriteString(titleStyle.Render(title) + "\n")
 
 			if m.statusMessage != "" {
 				s.WriteString(statusStyle.Render("▸ "+m.statusMessage) + "\n")
 			}
+			s.WriteString(m.rateLimitNotice())
+			s.WriteString(m.quotaNotice())
 			s.WriteString("\n")
 		}
 
@@ -595,11 +938,18 @@ func (m *model) View() tea.View {
 			sortNames := []string{"Date", "Sender", "Subject"}
 			sortInfo := fmt.Sprintf("Sort: %s", sortNames[m.sortBy])
 			s.WriteString(helpStyle.Render(sortInfo) + " ")
+			if notice := m.tokenNotice(); notice != "" {
+				s.WriteString(helpStyle.Render("• "+notice) + " ")
+			}
 			s.WriteString(helpStyle.Render("• Press "+keyStyle.Render("?")+" for help") + "\n")
 
-			helpText := keyStyle.Render("↑/↓") + "/" + keyStyle.Render("j/k") + ":navigate " + keyStyle.Render("enter") + ":open " + keyStyle.Render("s") + ":sort " + keyStyle.Render("c") + ":copy " + keyStyle.Render("v") + ":bulk " + keyStyle.Render("r") + ":refresh " + keyStyle.Render("/") + ":search "
+			helpText := keyStyle.Render("↑/↓") + "/" + keyStyle.Render("j/k") + ":navigate " + keyStyle.Render("enter") + ":open " + keyStyle.Render("s") + ":sort " + keyStyle.Render("c") + ":copy " + keyStyle.Render("u") + ":read " + keyStyle.Render("f") + ":flag " + keyStyle.Render("v") + ":bulk " + keyStyle.Render("r") + ":refresh " + keyStyle.Render("/") + ":search "
 			if m.autoRefresh {
-				helpText += keyStyle.Render("a") + ":auto:" + keyStyle.Render("ON")
+				mode := "ON"
+				if m.events != nil {
+					mode = "LIVE"
+				}
+				helpText += keyStyle.Render("a") + ":auto:" + keyStyle.Render(mode)
 			} else {
 				helpText += keyStyle.Render("a") + ":auto:" + keyStyle.Render("OFF")
 			}
@@ -614,7 +964,8 @@ func (m *model) View() tea.View {
 			s.WriteString(renderConfirmDialog(m.confirmData.(string)))
 		default:
 			s.WriteString(baseStyle.Render(m.viewport.View()) + "\n")
-			s.WriteString(helpStyle.Render("↑/↓ • " + keyStyle.Render("o") + ":browser • " + keyStyle.Render("c") + ":copy • " + keyStyle.Render("d") + ":delete • esc • " + keyStyle.Render("?") + ":help"))
+			s.WriteString(m.renderDownloads())
+			s.WriteString(helpStyle.Render("↑/↓ • " + keyStyle.Render("o") + ":browser • " + keyStyle.Render("R") + ":source • " + keyStyle.Render("u") + ":unread • " + keyStyle.Render("f") + ":flag • " + keyStyle.Render("c") + ":copy • " + keyStyle.Render("d") + ":delete • esc • " + keyStyle.Render("?") + ":help"))
 		}
 
 		content = s.String()
@@ -625,6 +976,40 @@ func (m *model) View() tea.View {
 	return v
 }
 
+// rateLimitNotice tells the user why requests stall while the server has
+// asked the client to back off.
+func (m *model) rateLimitNotice() string {
+	state := m.client.RateLimitState()
+	if !state.Limited() {
+		return ""
+	}
+	wait := time.Until(state.ResumeAt).Round(time.Second)
+	return "  " + errorStyle.Render(fmt.Sprintf("⏸ Rate limited, resuming in %ds", max(int(wait.Seconds()), 1))) + "\n"
+}
+
+// tokenNotice shows how long the session token has left. The client renews
+// it shortly before it runs out, so this only counts down while idle.
+func (m *model) tokenNotice() string {
+	exp := m.client.TokenExpiresAt()
+	if exp.IsZero() {
+		return ""
+	}
+	if time.Until(exp) <= 0 {
+		return "Token expired, renewing on next request"
+	}
+	return "Token expires in " + formatRemaining(time.Until(exp))
+}
+
+// quotaNotice warns once the mailbox is close to its quota, after which the
+// server starts rejecting new mail.
+func (m *model) quotaNotice() string {
+	if m.account == nil || m.account.QuotaUsage() < quotaWarningThreshold {
+		return ""
+	}
+	return "  " + errorStyle.Render(fmt.Sprintf("⚠ Mailbox %.0f%% full (%s of %s), delete messages to keep receiving mail",
+		m.account.QuotaUsage()*100, formatBytes(m.account.Used), formatBytes(m.account.Quota))) + "\n"
+}
+
 func (m *model) filterMessages() {
 	if m.searchInput.Value() == "" {
 		m.filteredMsgs = m.messages
@@ -652,25 +1037,31 @@ func (m *model) updateColumnWidths(termWidth int) {
 	if termWidth < 80 {
 		newCols = []table.Column{
 			{Title: "✓", Width: 2},
+			{Title: "●", Width: 2},
+			{Title: "⚑", Width: 2},
 			{Title: "From", Width: 15},
-			{Title: "Subject", Width: maxInt(20, termWidth-30)},
+			{Title: "Subject", Width: maxInt(20, termWidth-34)},
 			{Title: "Date", Width: 10},
 		}
 	} else if termWidth < 120 {
 		newCols = []table.Column{
 			{Title: "✓", Width: 3},
+			{Title: "●", Width: 2},
+			{Title: "⚑", Width: 2},
 			{Title: "📎", Width: 3},
 			{Title: "From", Width: 20},
-			{Title: "Subject", Width: maxInt(25, termWidth-55)},
+			{Title: "Subject", Width: maxInt(25, termWidth-59)},
 			{Title: "Preview", Width: 15},
 			{Title: "Date", Width: 12},
 		}
 	} else {
 		newCols = []table.Column{
 			{Title: "✓", Width: 3},
+			{Title: "●", Width: 2},
+			{Title: "⚑", Width: 2},
 			{Title: "📎", Width: 3},
 			{Title: "From", Width: 25},
-			{Title: "Subject", Width: maxInt(30, termWidth-85)},
+			{Title: "Subject", Width: maxInt(30, termWidth-89)},
 			{Title: "Preview", Width: 25},
 			{Title: "Date", Width: 14},
 		}
@@ -710,25 +1101,32 @@ func (m *model) updateTableRows() {
 			attach = "📎"
 		}
 
-		preview := truncate(msg.Intro, previewWidth)
+		unread := " "
+		if !msg.Seen {
+			unread = "●"
+		}
+
+		flag := " "
+		if msg.Flagged {
+			flag = "⚑"
+		}
+
+		cells := map[string]string{
+			"✓":       checkbox,
+			"●":       unread,
+			"⚑":       flag,
+			"📎":       attach,
+			"From":    truncate(msg.From.Address, fromWidth),
+			"Subject": truncate(msg.Subject, subjectWidth),
+			"Preview": truncate(msg.Intro, previewWidth),
+			"Date":    msg.CreatedAt.Format("02/01 15:04"),
+		}
 
-		if len(cols) == 4 {
-			rows = append(rows, table.Row{
-				checkbox,
-				truncate(msg.From.Address, fromWidth),
-				truncate(msg.Subject, subjectWidth),
-				msg.CreatedAt.Format("02/01 15:04"),
-			})
-		} else if len(cols) == 6 {
-			rows = append(rows, table.Row{
-				checkbox,
-				attach,
-				truncate(msg.From.Address, fromWidth),
-				truncate(msg.Subject, subjectWidth),
-				preview,
-				msg.CreatedAt.Format("02/01 15:04"),
-			})
+		row := make(table.Row, 0, len(cols))
+		for _, col := range cols {
+			row = append(row, cells[col.Title])
 		}
+		rows = append(rows, row)
 	}
 	m.table.SetRows(rows)
 }
@@ -757,16 +1155,135 @@ func (m *model) sortMessages() {
 	}
 }
 
-func (m *model) updateMessageSeen(id string, seen bool) {
+// applyMessageState sets the read and flagged state of a message wherever
+// the model keeps a copy of it. Nil values are left alone.
+func (m *model) applyMessageState(id string, seen, flagged *bool) {
+	apply := func(msg *api.Message) {
+		if seen != nil {
+			msg.Seen = *seen
+		}
+		if flagged != nil {
+			msg.Flagged = *flagged
+		}
+	}
+
 	for i := range m.messages {
 		if m.messages[i].ID == id {
-			m.messages[i].Seen = seen
+			apply(&m.messages[i])
 			break
 		}
 	}
+	if detail, ok := m.messageDetails[id]; ok {
+		apply(&detail.Message)
+	}
+	if m.selectedMsg != nil && m.selectedMsg.ID == id {
+		apply(&m.selectedMsg.Message)
+		if m.currentView == detailView && !m.showSource {
+			m.viewport.SetContent(m.renderMessageDetail(m.selectedMsg))
+		}
+	}
 	m.refreshTable()
 }
 
+// currentMessage returns the open message, or the one under the cursor in
+// the list.
+func (m *model) currentMessage() *api.Message {
+	if m.currentView == detailView && m.selectedMsg != nil {
+		return &m.selectedMsg.Message
+	}
+	if m.currentView == listView {
+		if idx := m.table.Cursor(); idx >= 0 && idx < len(m.filteredMsgs) {
+			return &m.filteredMsgs[idx]
+		}
+	}
+	return nil
+}
+
+// toggleMessageState flips the read or flagged state locally right away and
+// on the server in the background, undoing it if the server refuses.
+func (m *model) toggleMessageState(toggleSeen bool) tea.Cmd {
+	current := m.currentMessage()
+	if current == nil {
+		return nil
+	}
+	id := current.ID
+
+	var seen, flagged, prevSeen, prevFlagged *bool
+	if toggleSeen {
+		next, prev := !current.Seen, current.Seen
+		seen, prevSeen = &next, &prev
+		if next {
+			m.statusMessage = "Marked as read"
+		} else {
+			m.statusMessage = "Marked as unread"
+		}
+	} else {
+		next, prev := !current.Flagged, current.Flagged
+		flagged, prevFlagged = &next, &prev
+		if next {
+			m.statusMessage = "Flagged"
+		} else {
+			m.statusMessage = "Unflagged"
+		}
+	}
+
+	m.applyMessageState(id, seen, flagged)
+	return updateMessageState(m.ctx, m.client, id, seen, flagged, prevSeen, prevFlagged)
+}
+
+// upsertMessage applies a pushed message to the list and reports whether it
+// was new.
+func (m *model) upsertMessage(message api.Message) bool {
+	for i := range m.messages {
+		if m.messages[i].ID == message.ID {
+			m.messages[i] = message
+			return false
+		}
+	}
+
+	m.messages = append([]api.Message{message}, m.messages...)
+	if m.totalItems >= 0 {
+		m.totalItems++
+	}
+	return true
+}
+
+// maybeLoadMore fetches the next page once the cursor reaches the last row.
+func (m *model) maybeLoadMore() tea.Cmd {
+	if !m.hasMore || m.loadingMore || m.loading || len(m.filteredMsgs) == 0 {
+		return nil
+	}
+	if m.table.Cursor() < len(m.filteredMsgs)-1 {
+		return nil
+	}
+
+	m.loadingMore = true
+	m.statusMessage = "Loading more messages..."
+	return loadMorePages(m.ctx, m.client, m.page+1)
+}
+
+// mergeFirstPage refreshes the newest page while keeping the older messages
+// that were lazy-loaded from later pages.
+func mergeFirstPage(first, current []api.Message) []api.Message {
+	if len(first) == 0 {
+		return first
+	}
+
+	oldest := first[len(first)-1].CreatedAt
+	seen := make(map[string]bool, len(first))
+	merged := make([]api.Message, 0, len(current))
+	for _, msg := range first {
+		seen[msg.ID] = true
+		merged = append(merged, msg)
+	}
+	for _, msg := range current {
+		if !seen[msg.ID] && msg.CreatedAt.Before(oldest) {
+			merged = append(merged, msg)
+		}
+	}
+	return merged
+}
+
 func (m *model) refreshTable() {
 	m.filterMessages()
 	m.sortMessages()
@@ -809,12 +1326,11 @@ func truncate(s string, max int) string {
 }
 
 func loadCache() *messageCache {
-	homeDir, err := os.UserHomeDir()
+	cacheFile, err := storage.CachePath(storage.Profile())
 	if err != nil {
 		return nil
 	}
 
-	cacheFile := filepath.Join(homeDir, cacheFileName)
 	data, err := os.ReadFile(cacheFile)
 	if err != nil {
 		return nil
@@ -829,7 +1345,7 @@ func loadCache() *messageCache {
 }
 
 func saveCache(messages []api.Message) {
-	homeDir, err := os.UserHomeDir()
+	cacheFile, err := storage.CachePath(storage.Profile())
 	if err != nil {
 		return
 	}
@@ -844,8 +1360,7 @@ func saveCache(messages []api.Message) {
 		return
 	}
 
-	cacheFile := filepath.Join(homeDir, cacheFileName)
-	_ = os.WriteFile(cacheFile, data, 0600)
+	_ = storage.WriteFile(cacheFile, data)
 }
 
 func (m *model) showConfirm(action, description string) (tea.Model, tea.Cmd) {
@@ -869,7 +1384,7 @@ func (m *model) executeConfirmedAction() (tea.Model, tea.Cmd) {
 		if m.selectedMsg != nil {
 			m.loading = true
 			m.statusMessage = "Deleting message..."
-			return m, deleteMessage(m.client, m.selectedMsg.ID)
+			return m, deleteMessage(m.ctx, m.client, m.selectedMsg.ID)
 		}
 
 	case "delete_bulk":
@@ -881,7 +1396,7 @@ func (m *model) executeConfirmedAction() (tea.Model, tea.Cmd) {
 		}
 		m.loading = true
 		m.statusMessage = fmt.Sprintf("Deleting %d messages...", len(ids))
-		return m, bulkDeleteMessages(m.client, ids)
+		return m, bulkDeleteMessages(m.ctx, m.client, ids)
 	}
 
 	return m, nil
@@ -892,6 +1407,10 @@ func (m *model) renderMessageDetail(msg *api.MessageDetail) string {
 	content.WriteString(headerStyle.Render("From: ") + msg.From.Address + "\n")
 	content.WriteString(headerStyle.Render("Subject: ") + msg.Subject + "\n")
 	content.WriteString(headerStyle.Render("Date: ") + msg.CreatedAt.Format("02/01/2006 15:04:05") + "\n")
+	content.WriteString(headerStyle.Render("ID: ") + descStyle.Render(msg.ID) + "\n")
+	if msg.Flagged {
+		content.WriteString(headerStyle.Render("⚑ Flagged") + "\n")
+	}
 	content.WriteString(separatorStyle.Render(strings.Repeat("─", 80)) + "\n\n")
 
 	if msg.Text != "" {
@@ -914,6 +1433,11 @@ func (m *model) renderMessageDetail(msg *api.MessageDetail) string {
 	return content.String()
 }
 
+// renderSource shows the raw message as-is, minus the CRs of CRLF endings
+func renderSource(source string) string {
+	return strings.ReplaceAll(source, "\r\n", "\n")
+}
+
 func (m *model) writeAttachments(content *strings.Builder, attachments []api.Attachment) {
 	content.WriteString("\n\n" + separatorStyle.Render(strings.Repeat("─", 80)) + "\n")
 	content.WriteString(headerStyle.Render(fmt.Sprintf("📎 Attachments (%d)", len(attachments))) + "\n\n")
@@ -954,7 +1478,9 @@ func renderHelpScreen(_, _ int) string {
 				{"/", "Search messages"},
 				{"s", "Cycle sort (Date → Sender → Subject)"},
 				{"c", "Copy sender email to clipboard"},
-				{"a", "Toggle auto-refresh (every 10s)"},
+				{"u", "Toggle read/unread"},
+				{"f", "Flag/unflag message"},
+				{"a", "Toggle auto-refresh (live push, or every 10s)"},
 				{"v", "Toggle bulk selection mode"},
 				{"space", "Select/deselect message (bulk mode)"},
 				{"d", "Delete selected message(s)"},
@@ -965,7 +1491,10 @@ func renderHelpScreen(_, _ int) string {
 			items: [][2]string{
 				{"↑/↓ or j/k", "Scroll message content"},
 				{"o", "Open HTML content in browser"},
+				{"R", "Toggle raw message source"},
 				{"c", "Copy message content to clipboard"},
+				{"u", "Toggle read/unread"},
+				{"f", "Flag/unflag message"},
 				{"d", "Delete message"},
 				{"1-9", "Download attachment by number"},
 				{"shift+a", "Download all attachments"},
@@ -1032,29 +1561,6 @@ func getDownloadsDir() string {
 	return downloadsDir
 }
 
-func downloadAttachment(client *api.Client, messageID string, att api.Attachment) {
-	data, err := client.DownloadAttachment(messageID, att.ID)
-	if err != nil {
-		return
-	}
-
-	downloadsDir := getDownloadsDir()
-	filePath := filepath.Join(downloadsDir, att.Filename)
-	counter := 1
-	baseName := strings.TrimSuffix(att.Filename, filepath.Ext(att.Filename))
-	ext := filepath.Ext(att.Filename)
-
-	for {
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			break
-		}
-		filePath = filepath.Join(downloadsDir, fmt.Sprintf("%s_%d%s", baseName, counter, ext))
-		counter++
-	}
-
-	_ = os.WriteFile(filePath, data, 0644)
-}
-
 func (m *model) applyStyles() {
 	tableStyles := table.DefaultStyles()
 	tableStyles.Header = tableStyles.Header.
@@ -1078,13 +1584,22 @@ func (m *model) applyStyles() {
 	m.searchInput.SetStyles(tiStyles)
 }
 
-func runTUI(accountData *storage.AccountData, client *api.Client) error {
+// runTUI runs the inbox TUI until the user quits or ctx is cancelled.
+// Requests still in flight when the program exits are cancelled.
+func runTUI(ctx context.Context, accountData *storage.AccountData, client mailbox) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	client.SetToken(accountData.Token)
 
 	p := tea.NewProgram(
-		initialModel(accountData, client),
+		initialModel(ctx, accountData, client),
+		tea.WithContext(ctx),
 	)
 
 	_, err := p.Run()
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
 	return err
 }
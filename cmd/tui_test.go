@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"burnmail/api/apitest"
+	"burnmail/storage"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	tea "charm.land/bubbletea/v2"
+)
+
+func TestTUILoadsInboxAndWarnsNearQuota(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	srv := apitest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	address := "tui@" + apitest.DefaultDomain
+	account := srv.AddAccount(address, "secret123")
+	for i := 0; i < 3; i++ {
+		if _, err := srv.Deliver(address, apitest.Message{Subject: fmt.Sprintf("msg %d", i), Text: strings.Repeat("x", 300)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := srv.SetQuota(address, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	client := srv.Client()
+	if _, err := client.Login(ctx, address, "secret123"); err != nil {
+		t.Fatal(err)
+	}
+
+	m := initialModel(ctx, &storage.AccountData{Address: address, AccountID: account.ID}, client)
+	m.Update(loadMessages(ctx, client)())
+	m.Update(loadAccount(ctx, client)())
+
+	if len(m.messages) != 3 || m.loading {
+		t.Fatalf("model has %d messages, loading %v; want 3 loaded", len(m.messages), m.loading)
+	}
+	if notice := m.quotaNotice(); !strings.Contains(notice, "90% full") {
+		t.Errorf("quotaNotice() = %q, want a 90%% full warning", notice)
+	}
+	if notice := m.tokenNotice(); notice != "Token expires in 59m" {
+		t.Errorf("tokenNotice() = %q, want the remaining token lifetime", notice)
+	}
+}
+
+func TestTUIToggleFlagRevertsOnFailure(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	srv := apitest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	address := "flags@" + apitest.DefaultDomain
+	account := srv.AddAccount(address, "secret123")
+	if _, err := srv.Deliver(address, apitest.Message{Subject: "todo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	client := srv.Client()
+	if _, err := client.Login(ctx, address, "secret123"); err != nil {
+		t.Fatal(err)
+	}
+
+	m := initialModel(ctx, &storage.AccountData{Address: address, AccountID: account.ID}, client)
+	m.Update(loadMessages(ctx, client)())
+
+	if msg := m.toggleMessageState(false)(); msg != nil {
+		t.Fatalf("flagging failed: %v", msg)
+	}
+	if !m.messages[0].Flagged {
+		t.Fatal("message should be flagged locally")
+	}
+	if page, _ := client.GetMessagesPage(ctx, 1); !page.Messages[0].Flagged {
+		t.Error("message should be flagged on the server")
+	}
+
+	srv.Inject(apitest.Fault{Method: "PATCH", Status: http.StatusInternalServerError})
+	m.Update(m.toggleMessageState(false)())
+	if !m.messages[0].Flagged {
+		t.Error("a failed unflag should restore the flag")
+	}
+}
+
+func TestTUIRefreshesQuotaOnlyForNewMail(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	srv := apitest.NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	address := "quota@" + apitest.DefaultDomain
+	account := srv.AddAccount(address, "secret123")
+	if _, err := srv.Deliver(address, apitest.Message{Subject: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	client := srv.Client()
+	if _, err := client.Login(ctx, address, "secret123"); err != nil {
+		t.Fatal(err)
+	}
+
+	m := initialModel(ctx, &storage.AccountData{Address: address, AccountID: account.ID}, client)
+	meRequests := func() int {
+		n := 0
+		for _, r := range srv.Requests() {
+			if r == "GET /me" {
+				n++
+			}
+		}
+		return n
+	}
+	reload := func() {
+		t.Helper()
+		_, cmd := m.Update(loadMessages(ctx, client)())
+		runCmd(cmd)
+	}
+
+	reload()
+	reload()
+	if got := meRequests(); got != 1 {
+		t.Errorf("GET /me sent %d times for one new message and an unchanged reload, want 1", got)
+	}
+
+	if _, err := srv.Deliver(address, apitest.Message{Subject: "second"}); err != nil {
+		t.Fatal(err)
+	}
+	reload()
+	if got := meRequests(); got != 2 {
+		t.Errorf("GET /me sent %d times, want it refreshed after new mail", got)
+	}
+}
+
+// runCmd runs cmd and every command batched into it, dropping their
+// messages.
+func runCmd(cmd tea.Cmd) {
+	if cmd == nil {
+		return
+	}
+	if batch, ok := cmd().(tea.BatchMsg); ok {
+		for _, c := range batch {
+			runCmd(c)
+		}
+	}
+}
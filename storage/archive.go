@@ -0,0 +1,470 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// An archive keeps encrypted copies of an account's mail, so it can still
+// be read once the server has dropped it:
+//
+//	$XDG_DATA_HOME/burnmail/archive/<profile>/<account id>/key          data key
+//	$XDG_DATA_HOME/burnmail/archive/<profile>/<account id>/info         ArchiveInfo
+//	$XDG_DATA_HOME/burnmail/archive/<profile>/<account id>/<kind>/<id>  records
+//
+// The data key is random and sealed like the account file, with the secret
+// of the profile. Records are sealed with the data key itself, so reading a
+// thousand messages costs a single key derivation. A record is written a
+// chunk at a time, so attachments never sit in memory whole:
+//
+//	nonce prefix | chunk | chunk | ... | last chunk
+//
+// Each chunk is up to archiveChunkSize bytes of AES-256-GCM ciphertext,
+// bound to the kind and ID of the record. Its nonce is the prefix, its index
+// and whether it is the last, so chunks cannot be reordered, dropped or cut
+// off the end without decryption failing.
+//
+// An archive outlives its account: deleting the account keeps it, and the
+// secret of the profile, until PurgeArchive.
+
+const (
+	archiveChunkSize = 64 * 1024
+	// The rest of the nonce holds the index of the chunk and a flag for
+	// the last one.
+	noncePrefixSize = nonceSize - 5
+)
+
+// errDamaged is returned by read for a file that fails to decrypt.
+var errDamaged = errors.New("damaged")
+
+var archiveNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]{0,127}$`)
+
+// Archive is the archive of one account.
+type Archive struct {
+	dir string
+	key []byte
+}
+
+// ArchiveInfo describes the account an archive belongs to, so that it can
+// be read once the account file is gone.
+type ArchiveInfo struct {
+	AccountID string `json:"accountId"`
+	Address   string `json:"address"`
+	CreatedAt string `json:"createdAt,omitempty"`
+}
+
+func archiveRoot(profile string) (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "archive", profile), nil
+}
+
+func validateArchiveName(name string) error {
+	if !archiveNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid archive name %q", name)
+	}
+	return nil
+}
+
+func archiveKeyAD(profile, accountID string) []byte {
+	return []byte("burnmail archive " + profile + "/" + accountID)
+}
+
+// OpenArchive opens the archive of an account in a profile, creating its
+// data key on first use. The archive is never written unencrypted: where
+// Save would fall back to plaintext, it returns ErrNoProtection.
+func OpenArchive(profile, accountID string) (*Archive, error) {
+	if err := validateArchiveName(accountID); err != nil {
+		return nil, err
+	}
+	root, err := archiveRoot(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(root, accountID)
+	keyPath := filepath.Join(dir, "key")
+	ad := archiveKeyAD(profile, accountID)
+
+	var key []byte
+	err = withLock(keyPath, func() error {
+		sealed, err := os.ReadFile(keyPath)
+		if err == nil {
+			if key, _, err = open(profile, ad, sealed); err != nil {
+				return fmt.Errorf("archive key: %w", err)
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		key = make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		sealed, protection, err := seal(profile, ad, key)
+		if err != nil {
+			return err
+		}
+		if protection == ProtectionPlaintext {
+			return ErrNoProtection
+		}
+		return WriteFile(keyPath, sealed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, errors.New("invalid archive key")
+	}
+
+	return &Archive{dir: dir, key: key}, nil
+}
+
+func (a *Archive) path(kind, id string) (string, error) {
+	if err := validateArchiveName(kind); err != nil {
+		return "", err
+	}
+	if err := validateArchiveName(id); err != nil {
+		return "", err
+	}
+	return filepath.Join(a.dir, kind, id), nil
+}
+
+// Put stores a record, replacing any earlier one of the same kind and ID.
+func (a *Archive) Put(kind, id string, data []byte) error {
+	path, err := a.path(kind, id)
+	if err != nil {
+		return err
+	}
+	return a.write(path, []byte(kind+"/"+id), writeBytes(data))
+}
+
+// PutStream stores a record written by fill, which may stream it, replacing
+// any earlier one of the same kind and ID. If fill fails, nothing is
+// stored.
+func (a *Archive) PutStream(kind, id string, fill func(w io.Writer) error) error {
+	path, err := a.path(kind, id)
+	if err != nil {
+		return err
+	}
+	return a.write(path, []byte(kind+"/"+id), fill)
+}
+
+// Get returns a record. A missing one yields an error satisfying
+// os.IsNotExist.
+func (a *Archive) Get(kind, id string) ([]byte, error) {
+	path, err := a.path(kind, id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := a.read(path, []byte(kind+"/"+id))
+	if errors.Is(err, errDamaged) {
+		return nil, fmt.Errorf("archived %s %s is damaged", kind, id)
+	}
+	return data, err
+}
+
+// SetInfo records which account the archive belongs to.
+func (a *Archive) SetInfo(info *ArchiveInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return a.write(filepath.Join(a.dir, "info"), []byte("info"), writeBytes(data))
+}
+
+// Info returns what SetInfo recorded. A missing one yields an error
+// satisfying os.IsNotExist.
+func (a *Archive) Info() (*ArchiveInfo, error) {
+	data, err := a.read(filepath.Join(a.dir, "info"), []byte("info"))
+	if errors.Is(err, errDamaged) {
+		return nil, errors.New("archive info is damaged")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var info ArchiveInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// write seals what fill writes with the data key, bound to ad, into path.
+func (a *Archive) write(path string, ad []byte, fill func(w io.Writer) error) error {
+	gcm, err := newGCM(a.key)
+	if err != nil {
+		return err
+	}
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return err
+	}
+
+	return writeFileFrom(path, func(w io.Writer) error {
+		if _, err := w.Write(prefix); err != nil {
+			return err
+		}
+		sw := &sealingWriter{w: w, gcm: gcm, ad: ad, prefix: prefix, buf: make([]byte, 0, archiveChunkSize)}
+		if err := fill(sw); err != nil {
+			return err
+		}
+		return sw.seal(true)
+	})
+}
+
+func (a *Archive) read(path string, ad []byte) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	gcm, err := newGCM(a.key)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, errDamaged
+	}
+
+	var data []byte
+	chunk := make([]byte, archiveChunkSize+gcm.Overhead())
+	for index := uint32(0); ; index++ {
+		n, err := io.ReadFull(r, chunk)
+		if err == io.EOF {
+			return nil, errDamaged
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		last := err == io.ErrUnexpectedEOF
+		if !last {
+			_, err := r.Peek(1)
+			last = err == io.EOF
+		}
+
+		data, err = gcm.Open(data, chunkNonce(prefix, index, last), chunk[:n], ad)
+		if err != nil {
+			return nil, errDamaged
+		}
+		if last {
+			return data, nil
+		}
+	}
+}
+
+// sealingWriter seals what is written to it into chunks of
+// archiveChunkSize. A full chunk is only sealed once more follows, so that
+// the last one can be marked as such.
+type sealingWriter struct {
+	w      io.Writer
+	gcm    cipher.AEAD
+	ad     []byte
+	prefix []byte
+	index  uint32
+	buf    []byte
+}
+
+func (s *sealingWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if len(s.buf) == archiveChunkSize {
+			if err := s.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(s.buf[len(s.buf):archiveChunkSize], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// seal writes out the buffered chunk.
+func (s *sealingWriter) seal(last bool) error {
+	if s.index == math.MaxUint32 {
+		return errors.New("record too large")
+	}
+	sealed := s.gcm.Seal(nil, chunkNonce(s.prefix, s.index, last), s.buf, s.ad)
+	s.index++
+	s.buf = s.buf[:0]
+	_, err := s.w.Write(sealed)
+	return err
+}
+
+func chunkNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], index)
+	if last {
+		nonce[nonceSize-1] = 1
+	}
+	return nonce
+}
+
+// Has reports whether a record is stored, without decrypting it.
+func (a *Archive) Has(kind, id string) bool {
+	path, err := a.path(kind, id)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// List returns the sorted IDs of the records of a kind.
+func (a *Archive) List(kind string) ([]string, error) {
+	if err := validateArchiveName(kind); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(a.dir, kind))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		// Temporary files of WriteFile start with a dot.
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+			ids = append(ids, entry.Name())
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Remove deletes a record. A missing one is not an error.
+func (a *Archive) Remove(kind, id string) error {
+	path, err := a.path(kind, id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ListArchives returns the sorted account IDs of the archives of a profile.
+func ListArchives(profile string) ([]string, error) {
+	root, err := archiveRoot(profile)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(root, "*", "key"))
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, path := range paths {
+		ids = append(ids, filepath.Base(filepath.Dir(path)))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// ArchiveProfiles returns the sorted names of the profiles holding at least
+// one archive, with or without an account.
+func ArchiveProfiles() ([]string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "archive", "*", "*", "key"))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, path := range paths {
+		name := filepath.Base(filepath.Dir(filepath.Dir(path)))
+		if ValidateProfileName(name) == nil && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// PurgeArchive deletes the archive of an account in a profile. Once the
+// profile has neither an account nor an archive left, its secret is
+// deleted too.
+func PurgeArchive(profile, accountID string) error {
+	if err := validateArchiveName(accountID); err != nil {
+		return err
+	}
+	root, err := archiveRoot(profile)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(root, accountID)); err != nil {
+		return err
+	}
+
+	left, err := ListArchives(profile)
+	if err != nil {
+		return err
+	}
+	if len(left) == 0 {
+		_ = os.RemoveAll(root)
+		if !ProfileExists(profile) {
+			deleteSecret(profile)
+		}
+	}
+	return nil
+}
+
+// archiveKeys decrypts the data keys of every archive of a profile, by key
+// file.
+func archiveKeys(profile string) (map[string][]byte, error) {
+	root, err := archiveRoot(profile)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(root, "*", "key"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		sealed, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		accountID := filepath.Base(filepath.Dir(path))
+		key, _, err := open(profile, archiveKeyAD(profile, accountID), sealed)
+		if err != nil {
+			return nil, fmt.Errorf("archive key of %s: %v", accountID, err)
+		}
+		keys[path] = key
+	}
+	return keys, nil
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestArchiveRecords(t *testing.T) {
+	isolateHome(t)
+	keyring.MockInit()
+
+	archive, err := OpenArchive(DefaultProfile, "account1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, body := range map[string]string{"m2": "second", "m1": "first"} {
+		if err := archive.Put("messages", id, []byte(body)); err != nil {
+			t.Fatalf("Put(%s) error = %v", id, err)
+		}
+	}
+
+	// A second run derives the same data key from the keyring.
+	reopened, err := OpenArchive(DefaultProfile, "account1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := reopened.Get("messages", "m1"); err != nil || string(data) != "first" {
+		t.Errorf("Get(m1) = %q, %v; want first", data, err)
+	}
+	if ids, err := reopened.List("messages"); err != nil || !reflect.DeepEqual(ids, []string{"m1", "m2"}) {
+		t.Errorf("List() = %v, %v; want [m1 m2]", ids, err)
+	}
+	if _, err := reopened.Get("messages", "missing"); !os.IsNotExist(err) {
+		t.Errorf("Get(missing) error = %v, want one satisfying os.IsNotExist", err)
+	}
+	if _, err := reopened.Get("messages", "../key"); err == nil {
+		t.Error("IDs reaching outside the archive should be rejected")
+	}
+
+	// Records are encrypted and bound to their ID.
+	dir := filepath.Join(reopened.dir, "messages")
+	raw, _ := os.ReadFile(filepath.Join(dir, "m1"))
+	if strings.Contains(string(raw), "first") {
+		t.Error("records should not be stored in the clear")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "m2"), raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Get("messages", "m2"); err == nil {
+		t.Error("a record copied over another should fail to decrypt")
+	}
+
+	if err := reopened.Remove("messages", "m1"); err != nil || reopened.Has("messages", "m1") {
+		t.Errorf("Remove() error = %v, record still there: %v", err, reopened.Has("messages", "m1"))
+	}
+
+}
+
+func TestArchiveStreamsRecordsInChunks(t *testing.T) {
+	isolateHome(t)
+	keyring.MockInit()
+
+	archive, err := OpenArchive(DefaultProfile, "account1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	large := bytes.Repeat([]byte("attachment "), archiveChunkSize/4)
+	err = archive.PutStream("attachments", "a1", func(w io.Writer) error {
+		_, err := io.Copy(w, iotest.HalfReader(bytes.NewReader(large)))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := archive.Get("attachments", "a1"); err != nil || !bytes.Equal(data, large) {
+		t.Fatalf("Get() = %d bytes, %v; want the %d streamed", len(data), err, len(large))
+	}
+
+	failed := errors.New("connection reset")
+	err = archive.PutStream("attachments", "a2", func(w io.Writer) error {
+		_, _ = w.Write([]byte("partial"))
+		return failed
+	})
+	if !errors.Is(err, failed) || archive.Has("attachments", "a2") {
+		t.Errorf("PutStream() error = %v, stored %v; want the error and nothing stored", err, archive.Has("attachments", "a2"))
+	}
+
+	// Cutting off whole chunks is noticed, not just damage within one.
+	path := filepath.Join(archive.dir, "attachments", "a1")
+	raw, _ := os.ReadFile(path)
+	chunk := archiveChunkSize + 16
+	if err := os.WriteFile(path, raw[:noncePrefixSize+2*chunk], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := archive.Get("attachments", "a1"); err == nil {
+		t.Error("a record cut off at a chunk boundary should fail to decrypt")
+	}
+}
+
+func TestArchiveOutlivesItsAccount(t *testing.T) {
+	isolateHome(t)
+	keyring.MockInit()
+
+	if err := Save(&AccountData{Address: "a@example.test", AccountID: "account1"}); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := OpenArchive(DefaultProfile, "account1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.SetInfo(&ArchiveInfo{AccountID: "account1", Address: "a@example.test"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Put("messages", "m1", []byte("kept")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteProfile(DefaultProfile); err != nil {
+		t.Fatal(err)
+	}
+	if profiles, _ := ArchiveProfiles(); !reflect.DeepEqual(profiles, []string{DefaultProfile}) {
+		t.Errorf("ArchiveProfiles() = %v, want the profile whose account is gone", profiles)
+	}
+	reopened, err := OpenArchive(DefaultProfile, "account1")
+	if err != nil {
+		t.Fatalf("the archive should still open once the account is deleted: %v", err)
+	}
+	if info, err := reopened.Info(); err != nil || info.Address != "a@example.test" {
+		t.Errorf("Info() = %+v, %v; want the address of the account", info, err)
+	}
+	if data, err := reopened.Get("messages", "m1"); string(data) != "kept" {
+		t.Errorf("Get(m1) = %q, %v; want it kept", data, err)
+	}
+
+	if err := PurgeArchive(DefaultProfile, "account1"); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := ListArchives(DefaultProfile); err != nil || len(ids) != 0 {
+		t.Errorf("ListArchives() = %v, %v; want none after purging", ids, err)
+	}
+	if _, err := keyring.Get(keyringService, DefaultProfile); !errors.Is(err, keyring.ErrNotFound) {
+		t.Errorf("the secret should go with the last archive, got %v", err)
+	}
+}
+
+func TestArchiveIsNeverPlaintext(t *testing.T) {
+	withoutKeyring(t)
+	SetInsecurePlaintext(true)
+
+	if _, err := OpenArchive(DefaultProfile, "account1"); !errors.Is(err, ErrNoProtection) {
+		t.Errorf("OpenArchive() error = %v, want ErrNoProtection", err)
+	}
+}
+
+func TestArchiveKeyErrorsNameTheArchive(t *testing.T) {
+	isolateHome(t)
+	keyring.MockInit()
+
+	if _, err := OpenArchive(DefaultProfile, "account1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Delete(keyringService, DefaultProfile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenArchive(DefaultProfile, "account1"); err == nil || !strings.HasPrefix(err.Error(), "archive key: ") {
+		t.Errorf("OpenArchive() error = %v, want it to name the archive key", err)
+	}
+}
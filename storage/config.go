@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// Config holds user settings. Unlike AccountData it contains no secrets and
+// is stored as plain JSON.
+type Config struct {
+	Provider string `json:"provider,omitempty"`
+	APIURL   string `json:"apiUrl,omitempty"`
+	Proxy    string `json:"proxy,omitempty"`
+	CACert   string `json:"caCert,omitempty"`
+	Profile  string `json:"profile,omitempty"`
+
+	Secrets *SecretsConfig `json:"secrets,omitempty"`
+	Archive *ArchiveConfig `json:"archive,omitempty"`
+}
+
+// ArchiveConfig controls the local message archive, which is on by default.
+type ArchiveConfig struct {
+	// Disabled stops messages from being archived.
+	Disabled bool `json:"disabled,omitempty"`
+	// Attachments archives the attachments of each message too.
+	Attachments bool `json:"attachments,omitempty"`
+}
+
+func getSettingsPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// LoadConfig reads the settings file. A missing file yields an empty Config.
+func LoadConfig() (*Config, error) {
+	path, err := getSettingsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Config{}, nil
+		}
+		return nil, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// SaveConfig writes the settings file.
+func SaveConfig(cfg *Config) error {
+	path, err := getSettingsPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return WriteFile(path, data)
+}
+
+// UpdateConfig reads the settings file, lets fn change it and writes it
+// back, holding a lock so concurrent processes do not undo each other's
+// changes. An error from fn is returned and nothing is written.
+func UpdateConfig(fn func(*Config) error) error {
+	path, err := getSettingsPath()
+	if err != nil {
+		return err
+	}
+
+	return withLock(path, func() error {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		if err := fn(cfg); err != nil {
+			return err
+		}
+		return SaveConfig(cfg)
+	})
+}
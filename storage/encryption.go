@@ -1,15 +1,29 @@
 package storage
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"errors"
+	"fmt"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/pbkdf2"
 )
 
+// Encrypted data is a versioned envelope:
+//
+//	"BMENC" | version | KDF id | KDF parameters | salt length | salt | nonce | ciphertext
+//
+// Everything before the nonce is authenticated along with the optional
+// associated data, so the parameters cannot be weakened and a record cannot
+// be moved to another context without decryption failing. Data without the
+// magic header is the original salt|nonce|ciphertext format keyed with
+// PBKDF2-SHA256; it is still read, but never written.
+
 const (
 	saltSize   = 32
 	nonceSize  = 12
@@ -17,44 +31,145 @@ const (
 	iterations = 100000
 )
 
+const (
+	envelopeVersion = 1
+	kdfArgon2id     = 1
+)
+
+var envelopeMagic = []byte("BMENC")
+
+// argon2Params are the Argon2id cost parameters stored in each envelope.
+type argon2Params struct {
+	time    uint32
+	memory  uint32 // KiB
+	threads uint8
+}
+
+// defaultArgon2 follows the second recommended option of RFC 9106.
+var defaultArgon2 = argon2Params{time: 3, memory: 64 * 1024, threads: 4}
+
+// Limits on parameters read from a file, so a tampered header cannot make
+// decryption take unbounded time or memory.
+const (
+	maxArgon2Time   = 16
+	maxArgon2Memory = 1024 * 1024
+)
+
+func (p argon2Params) key(password, salt []byte) []byte {
+	return argon2.IDKey(password, salt, p.time, p.memory, p.threads, keySize)
+}
+
+// deriveKey derives the key of the legacy format.
 func deriveKey(password, salt []byte) []byte {
 	return pbkdf2.Key(password, salt, iterations, keySize, sha256.New)
 }
 
+// Encrypt seals data with a key derived from password.
 func Encrypt(data []byte, password string) ([]byte, error) {
+	return EncryptWithAD(data, password, nil)
+}
+
+// EncryptWithAD seals data like Encrypt and binds it to associatedData,
+// which must be passed again to decrypt it.
+func EncryptWithAD(data []byte, password string, associatedData []byte) ([]byte, error) {
 	salt := make([]byte, saltSize)
 	if _, err := rand.Read(salt); err != nil {
 		return nil, err
 	}
 
-	key := deriveKey([]byte(password), salt)
+	params := defaultArgon2
+	header := append([]byte{}, envelopeMagic...)
+	header = append(header, envelopeVersion, kdfArgon2id)
+	header = binary.BigEndian.AppendUint32(header, params.time)
+	header = binary.BigEndian.AppendUint32(header, params.memory)
+	header = append(header, params.threads, byte(len(salt)))
+	header = append(header, salt...)
 
-	block, err := aes.NewCipher(key)
+	gcm, err := newGCM(params.key([]byte(password), salt))
 	if err != nil {
 		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, len(header)+nonceSize+len(data)+gcm.Overhead())
+	result = append(result, header...)
+	result = append(result, nonce...)
+	return gcm.Seal(result, nonce, data, concat(header, associatedData)), nil
+}
+
+// Decrypt opens data sealed by Encrypt, or by older versions.
+func Decrypt(data []byte, password string) ([]byte, error) {
+	return DecryptWithAD(data, password, nil)
+}
+
+// DecryptWithAD opens data sealed by EncryptWithAD with the same associated
+// data. Legacy data carries none, so associatedData is ignored for it.
+func DecryptWithAD(data []byte, password string, associatedData []byte) ([]byte, error) {
+	if !IsEnvelope(data) {
+		return decryptLegacy(data, password)
+	}
+
+	header, params, salt, err := parseHeader(data)
 	if err != nil {
 		return nil, err
 	}
 
-	nonce := make([]byte, nonceSize)
-	if _, err := rand.Read(nonce); err != nil {
+	rest := data[len(header):]
+	if len(rest) < nonceSize {
+		return nil, errors.New("invalid encrypted data")
+	}
+
+	gcm, err := newGCM(params.key([]byte(password), salt))
+	if err != nil {
 		return nil, err
 	}
+	return gcm.Open(nil, rest[:nonceSize], rest[nonceSize:], concat(header, associatedData))
+}
 
-	ciphertext := gcm.Seal(nil, nonce, data, nil)
+// IsEnvelope reports whether data is in the current format rather than the
+// legacy one.
+func IsEnvelope(data []byte) bool {
+	return bytes.HasPrefix(data, envelopeMagic)
+}
 
-	result := make([]byte, 0, saltSize+nonceSize+len(ciphertext))
-	result = append(result, salt...)
-	result = append(result, nonce...)
-	result = append(result, ciphertext...)
+// parseHeader splits off the envelope header and reads the KDF parameters
+// and salt from it.
+func parseHeader(data []byte) (header []byte, params argon2Params, salt []byte, err error) {
+	const fixed = 5 + 1 + 1 + 4 + 4 + 1 + 1 // magic, version, KDF, time, memory, threads, salt length
+	if len(data) < fixed {
+		return nil, params, nil, errors.New("invalid encrypted data")
+	}
 
-	return result, nil
+	pos := len(envelopeMagic)
+	if version := data[pos]; version != envelopeVersion {
+		return nil, params, nil, fmt.Errorf("unsupported encryption format version %d", version)
+	}
+	if kdf := data[pos+1]; kdf != kdfArgon2id {
+		return nil, params, nil, fmt.Errorf("unsupported key derivation function %d", kdf)
+	}
+	pos += 2
+
+	params.time = binary.BigEndian.Uint32(data[pos:])
+	params.memory = binary.BigEndian.Uint32(data[pos+4:])
+	params.threads = data[pos+8]
+	saltLen := int(data[pos+9])
+	pos += 10
+
+	if params.time == 0 || params.time > maxArgon2Time || params.memory > maxArgon2Memory || params.threads == 0 {
+		return nil, params, nil, errors.New("invalid key derivation parameters")
+	}
+	if saltLen == 0 || len(data) < pos+saltLen {
+		return nil, params, nil, errors.New("invalid encrypted data")
+	}
+
+	return data[:pos+saltLen], params, data[pos : pos+saltLen], nil
 }
 
-func Decrypt(data []byte, password string) ([]byte, error) {
+func decryptLegacy(data []byte, password string) ([]byte, error) {
 	if len(data) < saltSize+nonceSize {
 		return nil, errors.New("invalid encrypted data")
 	}
@@ -63,17 +178,21 @@ func Decrypt(data []byte, password string) ([]byte, error) {
 	nonce := data[saltSize : saltSize+nonceSize]
 	ciphertext := data[saltSize+nonceSize:]
 
-	key := deriveKey([]byte(password), salt)
-
-	block, err := aes.NewCipher(key)
+	gcm, err := newGCM(deriveKey([]byte(password), salt))
 	if err != nil {
 		return nil, err
 	}
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
 
-	gcm, err := cipher.NewGCM(block)
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
+	return cipher.NewGCM(block)
+}
 
-	return gcm.Open(nil, nonce, ciphertext, nil)
+func concat(a, b []byte) []byte {
+	return append(append(make([]byte, 0, len(a)+len(b)), a...), b...)
 }
@@ -2,9 +2,20 @@ package storage
 
 import (
 	"bytes"
+	"crypto/rand"
+	"os"
 	"testing"
+
+	"github.com/zalando/go-keyring"
 )
 
+func TestMain(m *testing.M) {
+	// Full-strength Argon2id takes a good fraction of a second per call;
+	// the format under test does not depend on the cost.
+	defaultArgon2 = argon2Params{time: 1, memory: 1024, threads: 1}
+	os.Exit(m.Run())
+}
+
 func TestEncryptDecrypt(t *testing.T) {
 	password := "test-password-123"
 	plaintext := []byte("This is a secret message")
@@ -91,3 +102,92 @@ func TestEncryptDecryptLargeData(t *testing.T) {
 		t.Error("Decrypted large data does not match")
 	}
 }
+
+// encryptLegacy writes the headerless PBKDF2 format of older versions.
+func encryptLegacy(t *testing.T, data []byte, password string) []byte {
+	t.Helper()
+	salt := make([]byte, saltSize)
+	nonce := make([]byte, nonceSize)
+	_, _ = rand.Read(salt)
+	_, _ = rand.Read(nonce)
+
+	gcm, err := newGCM(deriveKey([]byte(password), salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gcm.Seal(append(salt, nonce...), nonce, data, nil)
+}
+
+func TestDecryptLegacyFormat(t *testing.T) {
+	legacy := encryptLegacy(t, []byte("old secret"), "password")
+	if IsEnvelope(legacy) {
+		t.Fatal("legacy data should not look like an envelope")
+	}
+
+	decrypted, err := DecryptWithAD(legacy, "password", []byte("ignored for legacy data"))
+	if err != nil || string(decrypted) != "old secret" {
+		t.Errorf("Decrypt(legacy) = %q, %v", decrypted, err)
+	}
+}
+
+func TestEnvelopeAuthenticatesHeaderAndAD(t *testing.T) {
+	encrypted, err := EncryptWithAD([]byte("secret"), "password", []byte("profile a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEnvelope(encrypted) {
+		t.Fatal("Encrypt should write the versioned envelope")
+	}
+
+	if _, err := DecryptWithAD(encrypted, "password", []byte("profile a")); err != nil {
+		t.Fatalf("DecryptWithAD with the same associated data failed: %v", err)
+	}
+	if _, err := DecryptWithAD(encrypted, "password", []byte("profile b")); err == nil {
+		t.Error("DecryptWithAD should fail with other associated data")
+	}
+	if _, err := Decrypt(encrypted, "password"); err == nil {
+		t.Error("Decrypt should fail without the associated data")
+	}
+
+	tampered := bytes.Clone(encrypted)
+	tampered[len(envelopeMagic)+5]++ // low byte of the Argon2id time cost
+	if _, err := DecryptWithAD(tampered, "password", []byte("profile a")); err == nil {
+		t.Error("a modified header should fail to decrypt")
+	}
+
+	unknown := bytes.Clone(encrypted)
+	unknown[len(envelopeMagic)] = envelopeVersion + 1
+	if _, err := DecryptWithAD(unknown, "password", []byte("profile a")); err == nil {
+		t.Error("an unknown format version should be rejected")
+	}
+}
+
+func TestSaveUpgradesLegacyFile(t *testing.T) {
+	isolateHome(t)
+	keyring.MockInit()
+	if err := keyring.Set(keyringService, DefaultProfile, "keyring-key"); err != nil {
+		t.Fatal(err)
+	}
+
+	path, _ := profilePath(DefaultProfile)
+	legacy := encryptLegacy(t, []byte(`{"address":"old@example.test"}`), "keyring-key")
+	if err := WriteFile(path, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := Load()
+	if err != nil || account.Address != "old@example.test" {
+		t.Fatalf("Load() of a legacy file = %+v, %v", account, err)
+	}
+	if err := Save(account); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !IsEnvelope(data) {
+		t.Error("Save should rewrite the file in the versioned format")
+	}
+	if _, err := DecryptWithAD(data, "keyring-key", accountAD(DefaultProfile)); err != nil {
+		t.Errorf("upgraded file is not bound to its profile: %v", err)
+	}
+}
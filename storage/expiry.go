@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// The expiry of each profile with a TTL is also kept unencrypted in
+// DataDir/expiry.json, so expired accounts can be found without decrypting
+// every profile. It holds no address or secret, only profile names and times.
+
+func expiryIndexPath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "expiry.json"), nil
+}
+
+func loadExpiries(path string) (map[string]time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]time.Time{}, nil
+		}
+		return nil, err
+	}
+
+	expiries := map[string]time.Time{}
+	if err := json.Unmarshal(data, &expiries); err != nil {
+		return nil, err
+	}
+	return expiries, nil
+}
+
+// setExpiry records when the account of profile expires. A zero time
+// removes the profile from the index.
+func setExpiry(profile string, at time.Time) error {
+	path, err := expiryIndexPath()
+	if err != nil {
+		return err
+	}
+
+	return withLock(path, func() error {
+		expiries, err := loadExpiries(path)
+		if err != nil {
+			return err
+		}
+
+		// A missing entry reads as the zero time, which means no TTL.
+		if expiries[profile].Equal(at) {
+			return nil
+		}
+		if at.IsZero() {
+			delete(expiries, profile)
+		} else {
+			expiries[profile] = at.UTC()
+		}
+
+		data, err := json.MarshalIndent(expiries, "", "  ")
+		if err != nil {
+			return err
+		}
+		return WriteFile(path, data)
+	})
+}
+
+// ExpiredProfiles returns, sorted, the profiles whose account was saved
+// with an expiry that has passed by now.
+func ExpiredProfiles(now time.Time) ([]string, error) {
+	path, err := expiryIndexPath()
+	if err != nil {
+		return nil, err
+	}
+
+	expiries, err := loadExpiries(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name, at := range expiries {
+		if !at.After(now) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
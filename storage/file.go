@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile atomically replaces path with data, readable by the owner only,
+// creating any missing parent directories. The data is written to a
+// temporary file, synced and renamed over path, so a crash or a concurrent
+// reader never sees a partial file.
+func WriteFile(path string, data []byte) error {
+	return writeFile(path, writeBytes(data), os.Rename)
+}
+
+// CreateFile is WriteFile for a file that must not exist yet: if it does, an
+// error satisfying os.IsExist is returned and the file is left alone.
+func CreateFile(path string, data []byte) error {
+	return writeFile(path, writeBytes(data), os.Link)
+}
+
+// writeFileFrom is WriteFile with the content written by fill, which may
+// stream it. If fill fails, path is left alone.
+func writeFileFrom(path string, fill func(w io.Writer) error) error {
+	return writeFile(path, fill, os.Rename)
+}
+
+func writeBytes(data []byte) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}
+}
+
+func writeFile(path string, fill func(w io.Writer) error, commit func(tmp, path string) error) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	// CreateTemp makes the file with mode 0600.
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if err := fill(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := commit(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// withLock runs fn while holding an exclusive advisory lock on path. The
+// lock lives in a separate path+".lock" file, which is left in place so
+// every process locks the same file, and is honoured by other burnmail
+// processes as well as other goroutines.
+func withLock(path string, fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("lock %s: %v", path, err)
+	}
+	defer func() { _ = unlockFile(f) }()
+
+	return fn()
+}
@@ -0,0 +1,14 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package storage
+
+import "os"
+
+// Platforms without flock or LockFileEx get no cross-process locking;
+// writes are still atomic.
+
+func lockFile(*os.File) error { return nil }
+
+func unlockFile(*os.File) error { return nil }
+
+func syncDir(string) error { return nil }
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestWriteFileReplacesAtomically(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "data.json")
+
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFile(path, []byte(content)); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		if got, _ := os.ReadFile(path); string(got) != content {
+			t.Errorf("file holds %q, want %q", got, content)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d entries, want only the file", len(entries))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 && runtime.GOOS != "windows" {
+		t.Errorf("file mode = %v, want 0600", perm)
+	}
+}
+
+func TestCreateFileKeepsExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+
+	if err := CreateFile(path, []byte("mine")); err != nil {
+		t.Fatalf("CreateFile() error = %v", err)
+	}
+	if err := CreateFile(path, []byte("theirs")); !os.IsExist(err) {
+		t.Fatalf("second CreateFile() error = %v, want one satisfying os.IsExist", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "mine" {
+		t.Errorf("file holds %q, want the first content", got)
+	}
+}
+
+func TestConcurrentUpdatesAreNotLost(t *testing.T) {
+	withoutKeyring(t)
+	SetInsecurePlaintext(true)
+
+	if err := Create(&AccountData{Address: "a@example.test", Token: "0"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Create(&AccountData{Address: "b@example.test"}); !errors.Is(err, ErrAccountExists) {
+		t.Fatalf("second Create() error = %v, want ErrAccountExists", err)
+	}
+
+	const workers = 20
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			err := Update(func(data *AccountData) error {
+				n, err := strconv.Atoi(data.Token)
+				data.Token = strconv.Itoa(n + 1)
+				return err
+			})
+			if err != nil {
+				t.Errorf("Update() error = %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	data, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Token != strconv.Itoa(workers) {
+		t.Errorf("counter = %s after %d updates; some were lost", data.Token, workers)
+	}
+}
+
+func TestUpdateWithoutAccount(t *testing.T) {
+	withoutKeyring(t)
+
+	called := false
+	err := Update(func(*AccountData) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrNoAccount) || called {
+		t.Errorf("Update() error = %v, called = %v; want ErrNoAccount without calling fn", err, called)
+	}
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Migration is a file moved from its old place in the home directory.
+type Migration struct {
+	From string
+	To   string
+}
+
+// MigrateLegacyFiles moves the dotfiles older versions kept in the home
+// directory (~/.burnmail.json, ~/.burnmail-config.json, ~/.burnmail-cache.json
+// and their per-profile variants) to the current layout. A file whose new
+// location is already taken is left where it is. It returns the moves made.
+func MigrateLegacyFiles() ([]Migration, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(filepath.Join(homeDir, ".burnmail*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var moved []Migration
+	var errs []error
+	for _, from := range matches {
+		to, err := legacyDestination(filepath.Base(from))
+		if err != nil || to == "" {
+			continue
+		}
+		if _, err := os.Stat(to); err == nil {
+			continue
+		}
+
+		if err := moveFile(from, to); err != nil {
+			errs = append(errs, fmt.Errorf("move %s: %v", from, err))
+			continue
+		}
+		moved = append(moved, Migration{From: from, To: to})
+	}
+	return moved, errors.Join(errs...)
+}
+
+// legacyDestination maps an old file name to its new path, or "" for files
+// that are not burnmail's.
+func legacyDestination(name string) (string, error) {
+	switch name {
+	case ".burnmail-config.json":
+		return getSettingsPath()
+	case ".burnmail.json":
+		return profilePath(DefaultProfile)
+	case ".burnmail-cache.json":
+		return CachePath(DefaultProfile)
+	}
+
+	if profile, ok := legacyProfile(name, ".burnmail-cache."); ok {
+		return CachePath(profile)
+	}
+	if profile, ok := legacyProfile(name, ".burnmail."); ok {
+		return profilePath(profile)
+	}
+	return "", nil
+}
+
+func legacyProfile(name, prefix string) (string, bool) {
+	rest, ok := strings.CutPrefix(name, prefix)
+	if !ok {
+		return "", false
+	}
+	profile := strings.TrimSuffix(rest, ".json")
+	return profile, ValidateProfileName(profile) == nil
+}
+
+// moveFile renames from to to, copying instead when they are on different
+// file systems.
+func moveFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	dst, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(to)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(to)
+		return err
+	}
+	return os.Remove(from)
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Burnmail keeps its files in the XDG base directories:
+//
+//	$XDG_CONFIG_HOME/burnmail/config.json               settings
+//	$XDG_DATA_HOME/burnmail/accounts/<profile>.json     encrypted accounts
+//	$XDG_CACHE_HOME/burnmail/messages/<profile>.json    message list caches
+//	$XDG_STATE_HOME/burnmail/debug.log                  HTTP traces of the TUI
+//
+// Unset variables default to ~/.config, ~/.local/share, ~/.cache and
+// ~/.local/state. When BURNMAIL_HOME is set, all four live directly in that
+// directory instead.
+
+const appDirName = "burnmail"
+
+// ConfigDir returns the directory holding the settings file.
+func ConfigDir() (string, error) {
+	return baseDir("XDG_CONFIG_HOME", ".config")
+}
+
+// DataDir returns the directory holding account data.
+func DataDir() (string, error) {
+	return baseDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+// CacheDir returns the directory holding data that can be rebuilt from the
+// server at any time.
+func CacheDir() (string, error) {
+	return baseDir("XDG_CACHE_HOME", ".cache")
+}
+
+// StateDir returns the directory holding logs.
+func StateDir() (string, error) {
+	return baseDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+}
+
+// DebugLogPath returns the file HTTP traces go to while the TUI owns the
+// terminal.
+func DebugLogPath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "debug.log"), nil
+}
+
+func baseDir(env, fallback string) (string, error) {
+	if dir := os.Getenv("BURNMAIL_HOME"); dir != "" {
+		return dir, nil
+	}
+	// The spec says relative paths in XDG variables are to be ignored.
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, appDirName), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, fallback, appDirName), nil
+}
+
+// CachePath returns the message cache file of a profile.
+func CachePath(profile string) (string, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "messages", profile+".json"), nil
+}
+
+func accountsDir() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "accounts"), nil
+}
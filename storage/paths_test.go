@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// isolateHome points HOME at a temporary directory and clears every
+// variable that could move burnmail's files elsewhere.
+func isolateHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, env := range []string{"BURNMAIL_HOME", "XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_CACHE_HOME"} {
+		t.Setenv(env, "")
+	}
+	return home
+}
+
+func TestBaseDirs(t *testing.T) {
+	home := isolateHome(t)
+
+	check := func(name string, dir func() (string, error), want string) {
+		t.Helper()
+		if got, err := dir(); err != nil || got != want {
+			t.Errorf("%s() = %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	check("ConfigDir", ConfigDir, filepath.Join(home, ".config", "burnmail"))
+	check("DataDir", DataDir, filepath.Join(home, ".local", "share", "burnmail"))
+	check("CacheDir", CacheDir, filepath.Join(home, ".cache", "burnmail"))
+
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	t.Setenv("XDG_DATA_HOME", "relative/is/ignored")
+	check("ConfigDir", ConfigDir, filepath.Join("/xdg/config", "burnmail"))
+	check("DataDir", DataDir, filepath.Join(home, ".local", "share", "burnmail"))
+
+	t.Setenv("BURNMAIL_HOME", "/opt/burnmail")
+	check("ConfigDir", ConfigDir, "/opt/burnmail")
+	check("DataDir", DataDir, "/opt/burnmail")
+	check("CacheDir", CacheDir, "/opt/burnmail")
+}
+
+func TestMigrateLegacyFiles(t *testing.T) {
+	home := isolateHome(t)
+
+	legacy := map[string]string{
+		".burnmail.json":                "default account",
+		".burnmail.signup-a.json":       "signup account",
+		".burnmail-config.json":         `{"provider":"mailgw"}`,
+		".burnmail-cache.json":          "default cache",
+		".burnmail-cache.signup-a.json": "signup cache",
+		".burnmail-unrelated.json":      "not ours",
+	}
+	for name, content := range legacy {
+		if err := os.WriteFile(filepath.Join(home, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A file already in the new layout wins over its legacy copy.
+	cachePath, _ := CachePath(DefaultProfile)
+	if err := WriteFile(cachePath, []byte("newer cache")); err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := MigrateLegacyFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 4 {
+		t.Errorf("MigrateLegacyFiles() moved %d files, want 4: %v", len(moved), moved)
+	}
+
+	signupCache, _ := CachePath("signup-a")
+	want := map[string]string{
+		filepath.Join(home, ".local", "share", "burnmail", "accounts", "default.json"):  "default account",
+		filepath.Join(home, ".local", "share", "burnmail", "accounts", "signup-a.json"): "signup account",
+		filepath.Join(home, ".config", "burnmail", "config.json"):                       `{"provider":"mailgw"}`,
+		cachePath:   "newer cache",
+		signupCache: "signup cache",
+		filepath.Join(home, ".burnmail-cache.json"):     "default cache",
+		filepath.Join(home, ".burnmail-unrelated.json"): "not ours",
+	}
+	for path, content := range want {
+		if data, err := os.ReadFile(path); err != nil || string(data) != content {
+			t.Errorf("%s = %q, %v; want %q", path, data, err, content)
+		}
+	}
+
+	if cfg, err := LoadConfig(); err != nil || cfg.Provider != "mailgw" {
+		t.Errorf("LoadConfig() after migration = %+v, %v", cfg, err)
+	}
+	if moved, err := MigrateLegacyFiles(); err != nil || len(moved) != 0 {
+		t.Errorf("second MigrateLegacyFiles() = %v, %v; want nothing to do", moved, err)
+	}
+}
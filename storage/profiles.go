@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultProfile is used when no profile is chosen.
+const DefaultProfile = "default"
+
+var profileNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+var (
+	profileMu     sync.RWMutex
+	activeProfile = DefaultProfile
+)
+
+// ValidateProfileName checks that name can be used as a profile: lowercase
+// letters, digits, '-' and '_', starting with a letter or digit.
+func ValidateProfileName(name string) error {
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: use lowercase letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+// SetProfile selects the profile that Save, Load, Delete and Exists use.
+func SetProfile(name string) error {
+	if err := ValidateProfileName(name); err != nil {
+		return err
+	}
+	profileMu.Lock()
+	defer profileMu.Unlock()
+	activeProfile = name
+	return nil
+}
+
+// Profile returns the selected profile.
+func Profile() string {
+	profileMu.RLock()
+	defer profileMu.RUnlock()
+	return activeProfile
+}
+
+// profilePath returns the account file of a profile. Every profile has its
+// own file and its own keyring entry.
+func profilePath(name string) (string, error) {
+	dir, err := accountsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// ListProfiles returns the profiles that hold an account, the default one
+// first and the rest sorted by name.
+func ListProfiles() ([]string, error) {
+	dir, err := accountsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, match := range matches {
+		name := strings.TrimSuffix(filepath.Base(match), ".json")
+		if name != DefaultProfile && ValidateProfileName(name) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if ProfileExists(DefaultProfile) {
+		names = append([]string{DefaultProfile}, names...)
+	}
+	return names, nil
+}
+
+// ProfileExists reports whether a profile holds an account.
+func ProfileExists(name string) bool {
+	path, err := profilePath(name)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestValidateProfileName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"default", true},
+		{"signup-a", true},
+		{"qa_2", true},
+		{"", false},
+		{"-leading", false},
+		{"Upper", false},
+		{"../escape", false},
+		{"with.dot", false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateProfileName(tt.name); (err == nil) != tt.valid {
+			t.Errorf("ValidateProfileName(%q) error = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestProfilesAreIsolated(t *testing.T) {
+	isolateHome(t)
+	keyring.MockInit()
+	t.Cleanup(func() { _ = SetProfile(DefaultProfile) })
+
+	accounts := map[string]*AccountData{
+		DefaultProfile: {Address: "main@example.test", Password: "one"},
+		"signup-b":     {Address: "b@example.test", Password: "two"},
+		"signup-a":     {Address: "a@example.test", Password: "three"},
+	}
+	for name, account := range accounts {
+		if err := SetProfile(name); err != nil {
+			t.Fatal(err)
+		}
+		if err := Save(account); err != nil {
+			t.Fatalf("Save() in %s: %v", name, err)
+		}
+	}
+
+	profiles, err := ListProfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{DefaultProfile, "signup-a", "signup-b"}; !reflect.DeepEqual(profiles, want) {
+		t.Errorf("ListProfiles() = %v, want %v", profiles, want)
+	}
+
+	for name, want := range accounts {
+		got, err := LoadProfile(name)
+		if err != nil || got == nil || got.Address != want.Address {
+			t.Errorf("LoadProfile(%q) = %+v, %v; want %s", name, got, err, want.Address)
+		}
+		if secret, err := keyring.Get(keyringService, name); err != nil || secret == "" {
+			t.Errorf("profile %s has no keyring entry: %v", name, err)
+		}
+	}
+
+	if err := SetProfile("signup-a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if ProfileExists("signup-a") || !ProfileExists("signup-b") || !ProfileExists(DefaultProfile) {
+		t.Error("Delete() should only remove the selected profile")
+	}
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Protection says how an account file is protected at rest.
+type Protection string
+
+const (
+	// ProtectionKeyring encrypts with a random key kept in the OS keyring.
+	ProtectionKeyring Protection = "keyring"
+	// ProtectionPassphrase encrypts with a passphrase from
+	// BURNMAIL_PASSPHRASE or the prompt.
+	ProtectionPassphrase Protection = "passphrase"
+	// ProtectionEnv, ProtectionFile and ProtectionCommand encrypt with a
+	// secret from the matching SecretStore.
+	ProtectionEnv     Protection = "env"
+	ProtectionFile    Protection = "file"
+	ProtectionCommand Protection = "command"
+	// ProtectionPlaintext stores the account unencrypted. It is only used
+	// when allowed with SetInsecurePlaintext.
+	ProtectionPlaintext Protection = "plaintext"
+)
+
+// PassphraseEnv names the environment variable holding the passphrase used
+// when the keyring is unavailable.
+const PassphraseEnv = "BURNMAIL_PASSPHRASE"
+
+// ErrNoProtection is returned by Save when the keyring is unavailable, no
+// passphrase was given and plaintext storage is not allowed.
+var ErrNoProtection = errors.New("no keyring available and no passphrase given; set " + PassphraseEnv + " or allow plaintext storage")
+
+// ErrPlaintext is returned when loading an account file that is stored
+// unencrypted while plaintext storage is not allowed. Such a file carries no
+// proof that burnmail wrote it for this profile.
+var ErrPlaintext = errors.New("account file is not encrypted and plaintext storage is not allowed")
+
+var errNoPassphrase = errors.New("no passphrase given")
+
+var (
+	protectionMu     sync.Mutex
+	passphrasePrompt func(profile string, confirm bool) (string, error)
+	allowPlaintext   bool
+	passphrases      = make(map[string]string)
+)
+
+// SetPassphrasePrompt registers fn to ask for a profile's passphrase when
+// the keyring is unavailable and BURNMAIL_PASSPHRASE is unset. confirm is
+// set for a new passphrase, which should be typed twice.
+func SetPassphrasePrompt(fn func(profile string, confirm bool) (string, error)) {
+	protectionMu.Lock()
+	defer protectionMu.Unlock()
+	passphrasePrompt = fn
+}
+
+// SetInsecurePlaintext allows Save to write accounts unencrypted when
+// neither the keyring nor a passphrase is available.
+func SetInsecurePlaintext(allow bool) {
+	protectionMu.Lock()
+	defer protectionMu.Unlock()
+	allowPlaintext = allow
+}
+
+func plaintextAllowed() bool {
+	protectionMu.Lock()
+	defer protectionMu.Unlock()
+	return allowPlaintext
+}
+
+// passphrase returns the passphrase of a profile from BURNMAIL_PASSPHRASE,
+// from earlier in this process, or from the prompt.
+func passphrase(profile string, confirm bool) (string, error) {
+	if env := os.Getenv(PassphraseEnv); env != "" {
+		return env, nil
+	}
+
+	protectionMu.Lock()
+	cached, ok := passphrases[profile]
+	prompt := passphrasePrompt
+	protectionMu.Unlock()
+
+	if ok {
+		return cached, nil
+	}
+	if prompt == nil {
+		return "", errNoPassphrase
+	}
+
+	entered, err := prompt(profile, confirm)
+	if err != nil {
+		return "", err
+	}
+	if entered == "" {
+		return "", errNoPassphrase
+	}
+	rememberPassphrase(profile, entered)
+	return entered, nil
+}
+
+func rememberPassphrase(profile, passphrase string) {
+	protectionMu.Lock()
+	defer protectionMu.Unlock()
+	if passphrase == "" {
+		delete(passphrases, profile)
+		return
+	}
+	passphrases[profile] = passphrase
+}
+
+// accountAD binds an account file to its profile, so a file copied over
+// another profile's fails to decrypt instead of being used there.
+func accountAD(profile string) []byte {
+	return []byte("burnmail account " + profile)
+}
+
+// seal encrypts a file of a profile, bound to ad, with the secret of the
+// configured store. Without one it uses the best protection available: the
+// keyring, then a passphrase, then, only if allowed, none at all.
+func seal(profile string, ad, plaintext []byte) ([]byte, Protection, error) {
+	return sealWith(currentSecretStore(), profile, ad, plaintext)
+}
+
+// sealWith is seal with the given store instead of the configured one.
+func sealWith(store SecretStore, profile string, ad, plaintext []byte) ([]byte, Protection, error) {
+	if store != nil {
+		secret, err := store.Secret(profile, true)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s secret store: %w", store.Name(), err)
+		}
+		sealed, err := EncryptWithAD(plaintext, secret, ad)
+		return sealed, Protection(store.Name()), err
+	}
+
+	password, keyringErr := KeyringStore{}.Secret(profile, true)
+	if keyringErr == nil {
+		sealed, err := EncryptWithAD(plaintext, password, ad)
+		return sealed, ProtectionKeyring, err
+	}
+
+	pass, err := passphrase(profile, true)
+	if err == nil {
+		sealed, err := EncryptWithAD(plaintext, pass, ad)
+		return sealed, ProtectionPassphrase, err
+	}
+	if !errors.Is(err, errNoPassphrase) {
+		return nil, "", err
+	}
+
+	if plaintextAllowed() {
+		return plaintext, ProtectionPlaintext, nil
+	}
+	return nil, "", fmt.Errorf("%w (keyring: %v)", ErrNoProtection, keyringErr)
+}
+
+// open decrypts a file sealed for profile and ad with the secret of the
+// configured store or, without one, the keyring key and then the passphrase.
+func open(profile string, ad, data []byte) ([]byte, Protection, error) {
+	if store := currentSecretStore(); store != nil {
+		secret, err := store.Secret(profile, false)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot decrypt: %s secret store: %w", store.Name(), err)
+		}
+		plain, err := DecryptWithAD(data, secret, ad)
+		if err != nil {
+			if _, ok := store.(PassphraseStore); ok {
+				rememberPassphrase(profile, "")
+				return nil, "", errors.New("cannot decrypt: wrong passphrase")
+			}
+			return nil, "", fmt.Errorf("cannot decrypt with the %s secret", store.Name())
+		}
+		return plain, Protection(store.Name()), nil
+	}
+
+	password, keyringErr := keyring.Get(keyringService, profile)
+	if keyringErr == nil {
+		if plain, err := DecryptWithAD(data, password, ad); err == nil {
+			return plain, ProtectionKeyring, nil
+		}
+	}
+
+	pass, err := passphrase(profile, false)
+	if errors.Is(err, errNoPassphrase) {
+		if keyringErr != nil && !errors.Is(keyringErr, keyring.ErrNotFound) {
+			return nil, "", fmt.Errorf("cannot decrypt: keyring unavailable (%v) and no passphrase given; set %s", keyringErr, PassphraseEnv)
+		}
+		return nil, "", fmt.Errorf("cannot decrypt with the keyring key and no passphrase was given; set %s", PassphraseEnv)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	plain, err := DecryptWithAD(data, pass, ad)
+	if err != nil {
+		rememberPassphrase(profile, "")
+		return nil, "", errors.New("cannot decrypt: wrong passphrase")
+	}
+	return plain, ProtectionPassphrase, nil
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+// withoutKeyring makes every keyring call fail, as on a headless Linux box
+// with no Secret Service, and resets the protection settings afterwards.
+func withoutKeyring(t *testing.T) string {
+	t.Helper()
+	isolateHome(t)
+	t.Setenv(PassphraseEnv, "")
+	keyring.MockInitWithError(errors.New("no secret service"))
+	t.Cleanup(func() {
+		keyring.MockInit()
+		SetPassphrasePrompt(nil)
+		SetInsecurePlaintext(false)
+		rememberPassphrase(DefaultProfile, "")
+	})
+
+	path, err := profilePath(DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSaveRefusesPlaintextByDefault(t *testing.T) {
+	path := withoutKeyring(t)
+
+	err := Save(&AccountData{Address: "a@example.test", Password: "secret"})
+	if !errors.Is(err, ErrNoProtection) {
+		t.Fatalf("Save() error = %v, want ErrNoProtection", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("nothing should be written without protection")
+	}
+}
+
+func TestSaveFallsBackToPassphrase(t *testing.T) {
+	path := withoutKeyring(t)
+	t.Setenv(PassphraseEnv, "correct horse")
+
+	account := &AccountData{Address: "a@example.test", Password: "secret"}
+	if err := Save(account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Protection != ProtectionPassphrase {
+		t.Errorf("Protection = %q, want passphrase", account.Protection)
+	}
+	if data, _ := os.ReadFile(path); len(data) == 0 || json.Valid(data) {
+		t.Error("the account file should be encrypted")
+	}
+
+	loaded, err := Load()
+	if err != nil || loaded.Address != account.Address || loaded.Protection != ProtectionPassphrase {
+		t.Fatalf("Load() = %+v, %v", loaded, err)
+	}
+
+	t.Setenv(PassphraseEnv, "wrong horse")
+	if _, err := Load(); err == nil {
+		t.Error("Load() with the wrong passphrase should fail instead of reading garbage")
+	}
+}
+
+func TestPassphrasePromptAsksOnce(t *testing.T) {
+	withoutKeyring(t)
+
+	var prompts []bool
+	SetPassphrasePrompt(func(profile string, confirm bool) (string, error) {
+		prompts = append(prompts, confirm)
+		return "typed passphrase", nil
+	})
+
+	account := &AccountData{Address: "a@example.test"}
+	for i := 0; i < 2; i++ {
+		if err := Save(account); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(prompts) != 1 || !prompts[0] {
+		t.Errorf("prompted %v, want a single confirmed prompt", prompts)
+	}
+}
+
+func TestInsecurePlaintextIsOptIn(t *testing.T) {
+	path := withoutKeyring(t)
+	SetInsecurePlaintext(true)
+
+	account := &AccountData{Address: "a@example.test"}
+	if err := Save(account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Protection != ProtectionPlaintext {
+		t.Errorf("Protection = %q, want plaintext", account.Protection)
+	}
+	if loaded, err := Load(); err != nil || loaded.Protection != ProtectionPlaintext {
+		t.Errorf("Load() = %+v, %v", loaded, err)
+	}
+
+	// Without the opt-in, a plain file is refused: it could have been put
+	// there or copied from another profile.
+	SetInsecurePlaintext(false)
+	if _, err := Load(); !errors.Is(err, ErrPlaintext) {
+		t.Errorf("Load() error = %v, want ErrPlaintext", err)
+	}
+
+	SetInsecurePlaintext(true)
+	if err := os.WriteFile(path, []byte("\x00not json, not decryptable"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(); err == nil {
+		t.Error("undecryptable data must not be read as plaintext")
+	}
+}
+
+func TestEmptyPassphraseDeclinesWhenPlaintextAllowed(t *testing.T) {
+	withoutKeyring(t)
+	SetInsecurePlaintext(true)
+
+	var prompts []bool
+	SetPassphrasePrompt(func(_ string, confirm bool) (string, error) {
+		prompts = append(prompts, confirm)
+		return "", nil
+	})
+
+	account := &AccountData{Address: "a@example.test"}
+	if err := Save(account); err != nil {
+		t.Fatalf("Save() error = %v, want the plaintext fallback", err)
+	}
+	if account.Protection != ProtectionPlaintext {
+		t.Errorf("Protection = %q, want plaintext", account.Protection)
+	}
+	if loaded, err := Load(); err != nil || loaded.Protection != ProtectionPlaintext {
+		t.Errorf("Load() = %+v, %v", loaded, err)
+	}
+	if len(prompts) != 1 || !prompts[0] {
+		t.Errorf("prompted %v, want one prompt for a new passphrase and none to load", prompts)
+	}
+}
+
+func TestMigrateSecretsEncryptsPlaintextAccount(t *testing.T) {
+	path := withoutKeyring(t)
+	t.Cleanup(func() { SetSecretStore(nil) })
+	if err := WriteFile(path, []byte(`{"address":"a@example.test"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(PassphraseEnv, "correct horse")
+	if _, err := MigrateSecrets(&SecretsConfig{Store: "passphrase"}); err != nil {
+		t.Fatalf("MigrateSecrets() error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); json.Valid(data) {
+		t.Error("the account file should be encrypted")
+	}
+	if loaded, err := Load(); err != nil || loaded.Address != "a@example.test" || loaded.Protection != ProtectionPassphrase {
+		t.Errorf("Load() = %+v, %v", loaded, err)
+	}
+}
@@ -0,0 +1,431 @@
+package storage
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+)
+
+// SecretStore holds the secret that encrypts a profile's account file.
+type SecretStore interface {
+	// Name identifies the store in the config file and in messages.
+	Name() string
+	// Secret returns the secret of profile. When create is set, a missing
+	// secret is made, by generating or asking for one as the store allows.
+	Secret(profile string, create bool) (string, error)
+	// Delete forgets the secret of profile. Stores that cannot write
+	// ignore it.
+	Delete(profile string) error
+}
+
+// ErrSecretNotFound is returned by SecretStore.Secret when the store has no
+// secret for the profile.
+var ErrSecretNotFound = errors.New("no secret stored for this profile")
+
+// SecretsConfig selects the secret store in the config file. Store is one
+// of keyring, passphrase, env, file or command; the other fields configure
+// the last three. "{profile}" in File and Command is replaced with the
+// profile name.
+type SecretsConfig struct {
+	Store   string `json:"store"`
+	Env     string `json:"env,omitempty"`
+	File    string `json:"file,omitempty"`
+	Command string `json:"command,omitempty"`
+}
+
+// NewSecretStore builds the store described by cfg. A nil cfg or an empty
+// Store yields nil, which means the keyring with a passphrase fallback.
+func NewSecretStore(cfg *SecretsConfig) (SecretStore, error) {
+	if cfg == nil || cfg.Store == "" {
+		return nil, nil
+	}
+
+	switch cfg.Store {
+	case "keyring":
+		return KeyringStore{}, nil
+	case "passphrase":
+		return PassphraseStore{}, nil
+	case "env":
+		return EnvStore{Var: cmp.Or(cfg.Env, PassphraseEnv)}, nil
+	case "file":
+		if cfg.File == "" {
+			return nil, errors.New("the file secret store needs a file")
+		}
+		return FileStore{Path: cfg.File}, nil
+	case "command":
+		if cfg.Command == "" {
+			return nil, errors.New("the command secret store needs a command")
+		}
+		return CommandStore{Command: cfg.Command}, nil
+	}
+	return nil, fmt.Errorf("unknown secret store %q (use keyring, passphrase, env, file or command)", cfg.Store)
+}
+
+var (
+	secretStoreMu sync.RWMutex
+	secretStore   SecretStore
+)
+
+// SetSecretStore selects the store used by Save and Load. nil restores the
+// default: the keyring, falling back to a passphrase.
+func SetSecretStore(store SecretStore) {
+	secretStoreMu.Lock()
+	defer secretStoreMu.Unlock()
+	secretStore = store
+}
+
+func currentSecretStore() SecretStore {
+	secretStoreMu.RLock()
+	defer secretStoreMu.RUnlock()
+	return secretStore
+}
+
+// MigrateSecrets moves every profile to the store described by to. All
+// accounts and archive keys are decrypted with the current store and
+// encrypted with a secret from the new one before anything is written. The
+// files are then replaced, and restored if one fails; only once all are
+// written is the config switched and the old secrets deleted. It returns
+// the profiles moved.
+func MigrateSecrets(to *SecretsConfig) ([]string, error) {
+	next, err := NewSecretStore(to)
+	if err != nil {
+		return nil, err
+	}
+	if next == nil {
+		return nil, errors.New("no secret store to migrate to")
+	}
+
+	profiles, err := ListProfiles()
+	if err != nil {
+		return nil, err
+	}
+	// Profiles whose account is gone may still have archives to open.
+	archived, err := ArchiveProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range archived {
+		if !slices.Contains(profiles, name) {
+			profiles = append(profiles, name)
+		}
+	}
+
+	var (
+		files []migratedFile
+		moved []string
+	)
+	for _, name := range profiles {
+		profileFiles, err := resealProfile(next, name)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %v", name, err)
+		}
+		if len(profileFiles) == 0 {
+			continue
+		}
+		files = append(files, profileFiles...)
+		moved = append(moved, name)
+	}
+
+	err = replaceFiles(files, func() error {
+		return UpdateConfig(func(cfg *Config) error {
+			cfg.Secrets = to
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	previous := currentSecretStore()
+	SetSecretStore(next)
+
+	for _, name := range moved {
+		switch {
+		case previous != nil && previous.Name() != next.Name():
+			_ = previous.Delete(name)
+		case previous == nil && next.Name() != KeyringStore{}.Name():
+			_ = KeyringStore{}.Delete(name)
+		}
+	}
+	return moved, nil
+}
+
+// migratedFile is a file of a profile encrypted again by MigrateSecrets.
+type migratedFile struct {
+	path   string
+	sealed []byte
+}
+
+// resealProfile decrypts the account and archive keys of a profile and
+// encrypts them for store, without writing anything.
+func resealProfile(store SecretStore, profile string) ([]migratedFile, error) {
+	var files []migratedFile
+
+	// The account may have been deleted since the profiles were listed.
+	// Migrating is also how an unencrypted account gets encrypted, so it
+	// is read even when plaintext storage is not allowed.
+	account, err := loadProfile(profile, true)
+	if err != nil {
+		return nil, err
+	}
+	if account != nil {
+		path, err := profilePath(profile)
+		if err != nil {
+			return nil, err
+		}
+		jsonData, err := json.MarshalIndent(account, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		sealed, _, err := sealWith(store, profile, accountAD(profile), jsonData)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, migratedFile{path: path, sealed: sealed})
+	}
+
+	keys, err := archiveKeys(profile)
+	if err != nil {
+		return nil, err
+	}
+	for path, key := range keys {
+		accountID := filepath.Base(filepath.Dir(path))
+		sealed, _, err := sealWith(store, profile, archiveKeyAD(profile, accountID), key)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, migratedFile{path: path, sealed: sealed})
+	}
+	return files, nil
+}
+
+// replaceFiles writes every file under its lock and then runs commit. If a
+// write or commit fails, the files already written get their earlier
+// content back.
+func replaceFiles(files []migratedFile, commit func() error) error {
+	var previous [][]byte
+	restore := func() {
+		for i, data := range previous {
+			path := files[i].path
+			_ = withLock(path, func() error { return WriteFile(path, data) })
+		}
+	}
+
+	for _, file := range files {
+		err := withLock(file.path, func() error {
+			data, err := os.ReadFile(file.path)
+			if err != nil {
+				return err
+			}
+			if err := WriteFile(file.path, file.sealed); err != nil {
+				return err
+			}
+			previous = append(previous, data)
+			return nil
+		})
+		if err != nil {
+			restore()
+			return err
+		}
+	}
+
+	if err := commit(); err != nil {
+		restore()
+		return err
+	}
+	return nil
+}
+
+const keyringService = "burnmail"
+
+// KeyringStore keeps a random secret per profile in the OS keyring.
+type KeyringStore struct{}
+
+func (KeyringStore) Name() string { return string(ProtectionKeyring) }
+
+func (KeyringStore) Secret(profile string, create bool) (string, error) {
+	secret, err := keyring.Get(keyringService, profile)
+	if errors.Is(err, keyring.ErrNotFound) {
+		if !create {
+			return "", ErrSecretNotFound
+		}
+		secret, err = randomSecret()
+		if err != nil {
+			return "", err
+		}
+		if err := keyring.Set(keyringService, profile, secret); err != nil {
+			return "", err
+		}
+		return secret, nil
+	}
+	return secret, err
+}
+
+func (KeyringStore) Delete(profile string) error {
+	err := keyring.Delete(keyringService, profile)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// PassphraseStore uses BURNMAIL_PASSPHRASE, or asks for a passphrase with
+// the prompt registered by SetPassphrasePrompt.
+type PassphraseStore struct{}
+
+func (PassphraseStore) Name() string { return string(ProtectionPassphrase) }
+
+func (PassphraseStore) Secret(profile string, create bool) (string, error) {
+	return passphrase(profile, create)
+}
+
+func (PassphraseStore) Delete(profile string) error {
+	rememberPassphrase(profile, "")
+	return nil
+}
+
+// EnvStore reads the secret from an environment variable, the same for
+// every profile. It never prompts, which suits CI.
+type EnvStore struct {
+	Var string
+}
+
+func (s EnvStore) Name() string { return string(ProtectionEnv) }
+
+func (s EnvStore) Secret(string, bool) (string, error) {
+	if secret := os.Getenv(s.Var); secret != "" {
+		return secret, nil
+	}
+	return "", fmt.Errorf("%s is not set", s.Var)
+}
+
+func (s EnvStore) Delete(string) error { return nil }
+
+// FileStore reads the secret from a file, such as an age identity kept on
+// an encrypted volume: of an identity file, only the AGE-SECRET-KEY- line is
+// used, so its comments can change freely. Any other file is used whole. A
+// missing file is created with a random secret; if two processes race to
+// create it, both end up using the winner's.
+type FileStore struct {
+	Path string
+}
+
+func (s FileStore) Name() string { return string(ProtectionFile) }
+
+func (s FileStore) path(profile string) string {
+	path := strings.ReplaceAll(s.Path, "{profile}", profile)
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(homeDir, rest)
+		}
+	}
+	return path
+}
+
+func (s FileStore) Secret(profile string, create bool) (string, error) {
+	path := s.path(profile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && create {
+		data, err = s.create(path)
+	}
+	if os.IsNotExist(err) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	secret := fileSecret(data)
+	if secret == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return secret, nil
+}
+
+// fileSecret returns the key of an age identity file, or else the whole
+// file without surrounding space.
+func fileSecret(data []byte) string {
+	for line := range strings.Lines(string(data)) {
+		if key := strings.TrimSpace(line); strings.HasPrefix(key, "AGE-SECRET-KEY-") {
+			return key
+		}
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// create writes a random secret to path. If another process created the
+// file in the meantime, its secret is returned instead.
+func (s FileStore) create(path string) ([]byte, error) {
+	secret, err := randomSecret()
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(secret + "\n")
+
+	err = CreateFile(path, data)
+	if os.IsExist(err) {
+		return os.ReadFile(path)
+	}
+	return data, err
+}
+
+// Delete leaves the file alone: it may be an identity used for other things.
+func (s FileStore) Delete(string) error { return nil }
+
+// CommandStore runs a command, such as "pass show burnmail" or
+// "op read op://vault/burnmail/password", and uses its first line of output
+// as the secret. The command may prompt on the terminal.
+type CommandStore struct {
+	Command string
+}
+
+func (s CommandStore) Name() string { return string(ProtectionCommand) }
+
+func (s CommandStore) Secret(profile string, _ bool) (string, error) {
+	command := strings.ReplaceAll(s.Command, "{profile}", profile)
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var out bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("secret command %q failed: %v", command, err)
+	}
+
+	secret, _, _ := strings.Cut(out.String(), "\n")
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return "", fmt.Errorf("secret command %q printed nothing", command)
+	}
+	return secret, nil
+}
+
+func (s CommandStore) Delete(string) error { return nil }
+
+func randomSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestNewSecretStore(t *testing.T) {
+	tests := []struct {
+		cfg     *SecretsConfig
+		want    string
+		wantErr bool
+	}{
+		{nil, "", false},
+		{&SecretsConfig{}, "", false},
+		{&SecretsConfig{Store: "keyring"}, "keyring", false},
+		{&SecretsConfig{Store: "env"}, "env", false},
+		{&SecretsConfig{Store: "file", File: "/tmp/key"}, "file", false},
+		{&SecretsConfig{Store: "file"}, "", true},
+		{&SecretsConfig{Store: "command"}, "", true},
+		{&SecretsConfig{Store: "vault"}, "", true},
+	}
+
+	for _, tt := range tests {
+		store, err := NewSecretStore(tt.cfg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewSecretStore(%+v) error = %v, wantErr %v", tt.cfg, err, tt.wantErr)
+			continue
+		}
+		got := ""
+		if store != nil {
+			got = store.Name()
+		}
+		if got != tt.want {
+			t.Errorf("NewSecretStore(%+v) = %q, want %q", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	store := FileStore{Path: filepath.Join(t.TempDir(), "keys", "{profile}.key")}
+
+	if _, err := store.Secret("qa", false); !errors.Is(err, ErrSecretNotFound) {
+		t.Fatalf("Secret() of a missing file error = %v, want ErrSecretNotFound", err)
+	}
+
+	created, err := store.Secret("qa", true)
+	if err != nil || created == "" {
+		t.Fatalf("Secret(create) = %q, %v", created, err)
+	}
+	if again, err := store.Secret("qa", false); err != nil || again != created {
+		t.Errorf("Secret() = %q, %v; want the created secret", again, err)
+	}
+	if info, err := os.Stat(store.path("qa")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("secret file should be private: %v, %v", info, err)
+	}
+}
+
+func TestFileSecret(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"plain", "  s3cret\n", "s3cret"},
+		{"age identity", "# created: 2026-01-02T03:04:05Z\n# public key: age1abc\nAGE-SECRET-KEY-1XYZ\n", "AGE-SECRET-KEY-1XYZ"},
+		{"empty", "\n", ""},
+	}
+
+	for _, tt := range tests {
+		if got := fileSecret([]byte(tt.data)); got != tt.want {
+			t.Errorf("fileSecret() of %s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCommandStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+
+	secret, err := CommandStore{Command: "printf 'from-{profile}\\nsecond line'"}.Secret("qa", false)
+	if err != nil || secret != "from-qa" {
+		t.Errorf("Secret() = %q, %v; want the first line", secret, err)
+	}
+	if _, err := (CommandStore{Command: "exit 3"}).Secret("qa", false); err == nil {
+		t.Error("a failing command should be an error")
+	}
+	if _, err := (CommandStore{Command: "true"}).Secret("qa", false); err == nil {
+		t.Error("a command printing nothing should be an error")
+	}
+}
+
+func TestMigrateSecrets(t *testing.T) {
+	isolateHome(t)
+	keyring.MockInit()
+	t.Cleanup(func() {
+		SetSecretStore(nil)
+		_ = SetProfile(DefaultProfile)
+	})
+
+	for _, name := range []string{DefaultProfile, "qa"} {
+		if err := SetProfile(name); err != nil {
+			t.Fatal(err)
+		}
+		if err := Save(&AccountData{Address: name + "@example.test"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archive, err := OpenArchive("qa", "account1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Put("messages", "m1", []byte("kept")); err != nil {
+		t.Fatal(err)
+	}
+	// An archive whose account was deleted moves too.
+	if _, err := OpenArchive("gone", "account2"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TEST_BURNMAIL_SECRET", "ci secret")
+	moved, err := MigrateSecrets(&SecretsConfig{Store: "env", Env: "TEST_BURNMAIL_SECRET"})
+	if err != nil || strings.Join(moved, ",") != "default,qa,gone" {
+		t.Fatalf("MigrateSecrets() = %v, %v", moved, err)
+	}
+	if _, err := OpenArchive("gone", "account2"); err != nil {
+		t.Errorf("archive without an account should open with the new secret: %v", err)
+	}
+
+	if cfg, _ := LoadConfig(); cfg.Secrets == nil || cfg.Secrets.Store != "env" {
+		t.Errorf("config should select the env store, got %+v", cfg.Secrets)
+	}
+	for _, name := range moved {
+		if _, err := keyring.Get(keyringService, name); !errors.Is(err, keyring.ErrNotFound) {
+			t.Errorf("keyring entry of %s should be deleted, got %v", name, err)
+		}
+		if name == "gone" {
+			continue
+		}
+		account, err := LoadProfile(name)
+		if err != nil || account.Protection != ProtectionEnv {
+			t.Errorf("LoadProfile(%s) = %+v, %v", name, account, err)
+		}
+	}
+	if archive, err := OpenArchive("qa", "account1"); err != nil {
+		t.Errorf("archive should open with the new secret: %v", err)
+	} else if data, err := archive.Get("messages", "m1"); string(data) != "kept" {
+		t.Errorf("archived record = %q, %v; want it kept", data, err)
+	}
+
+	t.Setenv("TEST_BURNMAIL_SECRET", "")
+	if _, err := LoadProfile("qa"); err == nil {
+		t.Error("LoadProfile should fail once the secret is gone")
+	}
+}
+
+func TestMigrateSecretsChangesNothingOnFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	isolateHome(t)
+	keyring.MockInit()
+	t.Cleanup(func() {
+		SetSecretStore(nil)
+		_ = SetProfile(DefaultProfile)
+	})
+
+	for _, name := range []string{DefaultProfile, "qa"} {
+		if err := SetProfile(name); err != nil {
+			t.Fatal(err)
+		}
+		if err := Save(&AccountData{Address: name + "@example.test"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The new store has no secret for the second profile.
+	to := &SecretsConfig{Store: "command", Command: "test {profile} = default && echo secret"}
+	if _, err := MigrateSecrets(to); err == nil {
+		t.Fatal("MigrateSecrets() should fail when the new store cannot seal a profile")
+	}
+
+	if cfg, _ := LoadConfig(); cfg.Secrets != nil {
+		t.Errorf("config should keep the old store, got %+v", cfg.Secrets)
+	}
+	for _, name := range []string{DefaultProfile, "qa"} {
+		account, err := LoadProfile(name)
+		if err != nil || account.Protection != ProtectionKeyring {
+			t.Errorf("LoadProfile(%s) = %+v, %v; want it still sealed by the keyring", name, account, err)
+		}
+	}
+}
+
+func TestReplaceFilesRestoresOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+	for _, path := range paths {
+		if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := []migratedFile{{paths[0], []byte("new")}, {paths[1], []byte("new")}}
+	if err := replaceFiles(files, func() error { return errors.New("config is read-only") }); err == nil {
+		t.Fatal("replaceFiles() should return the commit error")
+	}
+	for _, path := range paths {
+		if data, _ := os.ReadFile(path); string(data) != "old" {
+			t.Errorf("%s = %q, want it restored", filepath.Base(path), data)
+		}
+	}
+}
@@ -1,14 +1,10 @@
 package storage
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"os"
-	"path/filepath"
-	"sync"
-
-	"github.com/zalando/go-keyring"
+	"time"
 )
 
 type AccountData struct {
@@ -17,75 +13,122 @@ type AccountData struct {
 	Token     string `json:"token"`
 	AccountID string `json:"accountId"`
 	CreatedAt string `json:"createdAt"`
+	APIURL    string `json:"apiUrl,omitempty"`
+
+	// ExpiresAt is when the account is to be burned; zero means never.
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	// Downloads lists the attachments saved from the account, which are
+	// deleted with it when it expires.
+	Downloads []string `json:"downloads,omitempty"`
+
+	// Protection is how the account is stored on disk, set by Load and Save.
+	Protection Protection `json:"-"`
 }
 
-const (
-	keyringService = "burnmail"
-	keyringUser    = "default"
-)
+// Expired reports whether the account has a TTL that has run out by now.
+func (a *AccountData) Expired(now time.Time) bool {
+	return !a.ExpiresAt.IsZero() && !a.ExpiresAt.After(now)
+}
 
-var (
-	configPath     string
-	configPathOnce sync.Once
-	configPathErr  error
-)
+// ErrAccountExists is returned by Create when the profile already holds an
+// account.
+var ErrAccountExists = errors.New("the profile already holds an account")
 
-func getConfigPath() (string, error) {
-	configPathOnce.Do(func() {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			configPathErr = err
-			return
-		}
-		configPath = filepath.Join(homeDir, ".burnmail.json")
+// ErrNoAccount is returned by Update when the profile has no account.
+var ErrNoAccount = errors.New("no account in this profile")
+
+// Save stores the account of the selected profile, encrypted with the
+// keyring key or a passphrase. It only writes plaintext when allowed with
+// SetInsecurePlaintext.
+func Save(data *AccountData) error {
+	profile := Profile()
+	return lockProfile(profile, func(string) error {
+		return saveProfile(profile, data)
 	})
-	return configPath, configPathErr
 }
 
-func getOrCreatePassword() (string, error) {
-	password, err := keyring.Get(keyringService, keyringUser)
-	if err == keyring.ErrNotFound {
-		randomBytes := make([]byte, 32)
-		if _, err := rand.Read(randomBytes); err != nil {
-			return "", err
+// Create stores a new account in the selected profile, unless another
+// process got there first, in which case it returns ErrAccountExists.
+func Create(data *AccountData) error {
+	profile := Profile()
+	return lockProfile(profile, func(path string) error {
+		if _, err := os.Stat(path); err == nil {
+			return ErrAccountExists
 		}
-		password = base64.StdEncoding.EncodeToString(randomBytes)
+		return saveProfile(profile, data)
+	})
+}
 
-		if err := keyring.Set(keyringService, keyringUser, password); err != nil {
-			return "", err
+// Update reads the account of the selected profile, lets fn change it and
+// saves it, holding the profile's lock throughout so that concurrent
+// processes do not lose each other's changes. An error from fn is returned
+// and nothing is written.
+func Update(fn func(*AccountData) error) error {
+	profile := Profile()
+	return lockProfile(profile, func(string) error {
+		data, err := LoadProfile(profile)
+		if err != nil {
+			return err
 		}
-	} else if err != nil {
-		return "", err
-	}
-	return password, nil
+		if data == nil {
+			return ErrNoAccount
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+		return saveProfile(profile, data)
+	})
 }
 
-func Save(data *AccountData) error {
-	path, err := getConfigPath()
+// lockProfile runs fn with the path of a profile's account file while
+// holding that file's lock.
+func lockProfile(profile string, fn func(path string) error) error {
+	path, err := profilePath(profile)
 	if err != nil {
 		return err
 	}
+	return withLock(path, func() error { return fn(path) })
+}
 
-	jsonData, err := json.MarshalIndent(data, "", "  ")
+func saveProfile(profile string, data *AccountData) error {
+	path, err := profilePath(profile)
 	if err != nil {
 		return err
 	}
 
-	password, err := getOrCreatePassword()
+	jsonData, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
-		return os.WriteFile(path, jsonData, 0600)
+		return err
 	}
 
-	encrypted, err := Encrypt(jsonData, password)
+	sealed, protection, err := seal(profile, accountAD(profile), jsonData)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(path, encrypted, 0600)
+	if err := WriteFile(path, sealed); err != nil {
+		return err
+	}
+	data.Protection = protection
+	return setExpiry(profile, data.ExpiresAt)
 }
 
+// Load reads the account of the selected profile. It returns nil, nil when
+// the profile has no account.
 func Load() (*AccountData, error) {
-	path, err := getConfigPath()
+	return LoadProfile(Profile())
+}
+
+// LoadProfile reads the account of the named profile. An unencrypted
+// account file is only read when plaintext storage is allowed.
+func LoadProfile(profile string) (*AccountData, error) {
+	return loadProfile(profile, plaintextAllowed())
+}
+
+// loadProfile is LoadProfile, reading an unencrypted account file only if
+// plaintext is set.
+func loadProfile(profile string, plaintext bool) (*AccountData, error) {
+	path, err := profilePath(profile)
 	if err != nil {
 		return nil, err
 	}
@@ -98,44 +141,61 @@ func Load() (*AccountData, error) {
 		return nil, err
 	}
 
-	password, err := getOrCreatePassword()
-	if err == nil {
-		decrypted, err := Decrypt(data, password)
-		if err == nil {
-			data = decrypted
+	plain, protection := data, ProtectionPlaintext
+	if !json.Valid(data) {
+		if plain, protection, err = open(profile, accountAD(profile), data); err != nil {
+			return nil, err
 		}
+	} else if !plaintext {
+		return nil, ErrPlaintext
 	}
 
 	var account AccountData
-	if err := json.Unmarshal(data, &account); err != nil {
+	if err := json.Unmarshal(plain, &account); err != nil {
 		return nil, err
 	}
+	account.Protection = protection
 
 	return &account, nil
 }
 
+// Delete removes the account of the selected profile. Its archives are
+// kept; see DeleteProfile.
 func Delete() error {
-	path, err := getConfigPath()
+	return DeleteProfile(Profile())
+}
+
+// DeleteProfile removes the account of the named profile. Its archives are
+// kept, and so is the secret that opens them until the last one is purged
+// with PurgeArchive.
+func DeleteProfile(profile string) error {
+	err := lockProfile(profile, func(path string) error {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	err = os.Remove(path)
-	if err != nil && !os.IsNotExist(err) {
-		return err
+	if archives, err := ListArchives(profile); err == nil && len(archives) == 0 {
+		deleteSecret(profile)
 	}
-
-	_ = keyring.Delete(keyringService, keyringUser)
-
-	return nil
+	return setExpiry(profile, time.Time{})
 }
 
+// Exists reports whether the selected profile holds an account.
 func Exists() bool {
-	path, err := getConfigPath()
-	if err != nil {
-		return false
-	}
+	return ProfileExists(Profile())
+}
 
-	_, err = os.Stat(path)
-	return err == nil
+// deleteSecret forgets the secret of a profile in the store that holds it.
+func deleteSecret(profile string) {
+	if store := currentSecretStore(); store != nil {
+		_ = store.Delete(profile)
+		return
+	}
+	_ = KeyringStore{}.Delete(profile)
+	rememberPassphrase(profile, "")
 }